@@ -1,10 +1,14 @@
 -- hexboard.lua — Neovim cursor integration
 --
--- Mirrors your editor cursor position to the hexboard display in real time.
--- The display has 4 rows × 32 columns; editor line/col are mapped with modulo.
+-- Mirrors the code you are editing to the hexboard display in real time: the
+-- four lines around the cursor, with the cursor on them. The board scrolls
+-- sideways to follow the cursor. With `mirror = false` only the cursor is
+-- sent, its line/col mapped onto the 4 rows × 32 columns with modulo.
+-- Every editor connected gets its own cursor on the board, so several people
+-- can follow each other. Set `id` to keep the same cursor across reconnects.
 --
 -- Usage (in init.lua):
---   require('path.to.hexboard').setup({ host = 'txt', port = 8082 })
+--   require('path.to.hexboard').setup({ host = 'txt', port = 8082, id = 'alice' })
 --
 -- Or source directly:
 --   vim.cmd('source /path/to/hexboard.lua')
@@ -17,8 +21,14 @@ local uv = vim.uv or vim.loop
 local config = {
 	host = 'txt',
 	port = 8082,
+	id   = nil,  -- client id (no spaces); nil: one cursor per connection
+	mirror = true, -- send the text around the cursor, not just its position
 }
 
+local ROWS = 4
+
+local top = 1  -- first buffer line shown, moved only to keep the cursor in view
+
 local conn    = nil  -- active TCP handle
 local pending = false
 
@@ -41,19 +51,132 @@ local function connect()
 	end)
 end
 
+-- Expand tabs the way they are displayed.
+local function expand_tabs(s)
+	local ts = vim.bo.tabstop
+	local out, width = {}, 0
+	for _, ch in ipairs(vim.fn.split(s, '\\zs')) do
+		if ch == '\t' then
+			local n = ts - width % ts
+			out[#out + 1] = string.rep(' ', n)
+			width = width + n
+		else
+			out[#out + 1] = ch
+			width = width + 1
+		end
+	end
+	return table.concat(out)
+end
+
+-- Display column of byte offset b (0-based) in raw line s.
+local function display_col(s, b)
+	return vim.fn.strchars(expand_tabs(s:sub(1, b)))
+end
+
+-- Marks for the visual selection ("invert") and the search hits
+-- ("underline") on the lines shown, as "<kind> <row> <col> <len>".
+local function marks(raw)
+	local out = {}
+	local function add(kind, row, col, len)
+		if len > 0 then
+			out[#out + 1] = kind .. ' ' .. row .. ' ' .. col .. ' ' .. len
+		end
+	end
+
+	local mode = vim.api.nvim_get_mode().mode
+	if mode == 'v' or mode == 'V' or mode == '\22' then
+		local v, c = vim.fn.getpos('v'), vim.api.nvim_win_get_cursor(0)
+		local l1, b1, l2, b2 = v[2], v[3] - 1, c[1], c[2]
+		if l1 > l2 or (l1 == l2 and b1 > b2) then
+			l1, b1, l2, b2 = l2, b2, l1, b1
+		end
+		local vc1, vc2 = vim.fn.virtcol('v'), vim.fn.virtcol('.')
+		for i, line in ipairs(raw) do
+			local n = top + i - 1
+			if n >= l1 and n <= l2 then
+				local width = vim.fn.strchars(expand_tabs(line))
+				if mode == 'V' then
+					add('invert', i - 1, 0, math.max(1, width))
+				elseif mode == 'v' then
+					local from = n == l1 and display_col(line, b1) or 0
+					local to = n == l2 and display_col(line, b2 + 1) or width
+					add('invert', i - 1, from, math.max(1, to - from))
+				else
+					local from = math.min(vc1, vc2)
+					add('invert', i - 1, from - 1, math.max(vc1, vc2) - from + 1)
+				end
+			end
+		end
+	end
+
+	if vim.o.hlsearch and vim.v.hlsearch == 1 then
+		local pat = vim.fn.getreg('/')
+		for i, line in ipairs(raw) do
+			local start = 0
+			while pat ~= '' and start <= #line do
+				local ok, m = pcall(vim.fn.matchstrpos, line, pat, start)
+				if not ok or m[2] < 0 then break end
+				local from, to = display_col(line, m[2]), display_col(line, m[3])
+				add('underline', i - 1, from, to - from)
+				start = math.max(m[3], m[2] + 1)
+			end
+		end
+	end
+
+	return 'MARKS ' .. #out .. '\n' .. table.concat(out, '\n') .. (#out > 0 and '\n' or '')
+end
+
+-- The view protocol: the marks, then "TEXT <lines> <row> <col> [id]" and
+-- the lines.
+local function view_message(pos)
+	local last = vim.api.nvim_buf_line_count(0)
+	if pos[1] < top then
+		top = pos[1]
+	elseif pos[1] >= top + ROWS then
+		top = pos[1] - ROWS + 1
+	end
+	top = math.max(1, math.min(top, last - ROWS + 1))
+
+	local raw = vim.api.nvim_buf_get_lines(0, top - 1, top - 1 + ROWS, false)
+	local lines = {}
+	for i, l in ipairs(raw) do
+		lines[i] = expand_tabs(l)
+	end
+	local col = display_col(vim.api.nvim_get_current_line(), pos[2])
+
+	local header = 'TEXT ' .. #lines .. ' ' .. (pos[1] - top) .. ' ' .. col
+	if config.id then
+		header = header .. ' ' .. config.id
+	end
+	return marks(raw) .. header .. '\n' .. table.concat(lines, '\n') .. (#lines > 0 and '\n' or '')
+end
+
+-- The cursor protocol: "<col> <row> [id]", mapped onto the 32×4 display
+-- grid with modulo.
+local function cursor_message(pos)
+	local col = pos[2] % 32
+	local row = (pos[1] - 1) % ROWS
+	local line = col .. ' ' .. row
+	if config.id then
+		line = line .. ' ' .. config.id
+	end
+	return line .. '\n'
+end
+
 local function send_position()
 	pending = false
 	if not conn then
 		connect()
 		return
 	end
-	-- Map editor position onto the 32×4 display grid.
-	-- row: editor line (1-based) → 0-3 via modulo
-	-- col: editor column (0-based) → 0-31 via modulo
 	local pos = vim.api.nvim_win_get_cursor(0)
-	local col = pos[2] % 32
-	local row = (pos[1] - 1) % 4
-	conn:write(col .. ' ' .. row .. '\n', function(err)
+	local msg
+	if config.mirror then
+		msg = view_message(pos)
+	else
+		msg = cursor_message(pos)
+	end
+	conn:write(msg, function(err)
 		if err then close_conn() end
 	end)
 end
@@ -82,6 +205,12 @@ function M.setup(opts)
 		desc  = 'hexboard: sync cursor position',
 		callback = on_cursor_moved,
 	})
+	if config.mirror then
+		vim.api.nvim_create_autocmd({ 'TextChanged', 'TextChangedI', 'BufEnter', 'ModeChanged' }, {
+			desc  = 'hexboard: sync text and selection',
+			callback = on_cursor_moved,
+		})
+	end
 	-- Reconnect if the connection drops
 	vim.api.nvim_create_autocmd('FocusGained', {
 		desc = 'hexboard: reconnect on focus',
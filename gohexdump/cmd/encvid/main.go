@@ -2,112 +2,175 @@ package main
 
 import (
 	"flag"
+	"fmt"
+	"image"
+	_ "image/jpeg"
+	_ "image/png"
 	"io"
 	"log"
 	"os"
 
+	"post6.net/gohexdump/internal/font"
 	"post6.net/gohexdump/internal/screen"
+	"post6.net/gohexdump/internal/segimage"
+	"post6.net/gohexdump/internal/segvideo"
 )
 
 var (
 	width  int
 	height int
+	sample string
+	gamma  float64
+	levels int
+	dither bool
+	text   bool
+	repeat int
+	fps    float64
+	bits   int
+	raw    bool
 )
 
 func init() {
 	flag.IntVar(&width, "width", 1280, "input video width in pixels")
 	flag.IntVar(&height, "height", 720, "input video height in pixels")
+	flag.StringVar(&sample, "sample", "area", "how segments sample the image: area (average under the segment) or point (the pixel at its centre)")
+	flag.Float64Var(&gamma, "gamma", 2.5, "gamma of the input and of playback, for averaging and dithering in linear light")
+	flag.IntVar(&levels, "levels", 0, "brightness levels per segment, 2 to 2^bits (default 2^bits)")
+	flag.BoolVar(&dither, "dither", false, "diffuse the error of fewer -levels across neighbouring segments")
+	flag.BoolVar(&text, "text", false, "text art: light each digit as the font glyph closest to the image")
+	flag.IntVar(&repeat, "repeat", 1, "frames to write for each image file")
+	flag.Float64Var(&fps, "fps", 30, "frame rate stored in the video")
+	flag.IntVar(&bits, "bits", 8, "bits per sample, 8 or 16")
+	flag.BoolVar(&raw, "raw", false, "write headerless raw video, one byte per segment, as older versions of playvid read")
+
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: %s [flags] [image ...]\n\n", os.Args[0])
+		fmt.Fprintf(flag.CommandLine.Output(), "Encodes raw grayscale video from stdin, or PNG/JPEG images, into segment video on stdout.\n\n")
+		flag.PrintDefaults()
+	}
 }
 
-// buildPositions builds a mapping from segment index -> pixel index in the input frame.
-//
-// For each segment i:
-//   - We get its physical coordinate via SegmentCoord(i)
-//   - Normalize all segment coordinates into [0..width-1] × [0..height-1]
-//   - Store the linear pixel index x + y*width in positions[i]
-//   - For the 16th segment in each digit (ix & 0xF == 0xF) we store -1 (unused)
-func buildPositions(w, h int) []int {
-	hex := screen.NewHexScreen()
+// encoder turns grayscale frames into segment frames.
+type encoder struct {
+	info   screen.ScreenInfo
+	glyphs []font.Glyph
+	conv   *segimage.Converter
+	levels []float64
+	out    *segvideo.Writer
+}
 
-	segCount := hex.SegmentCount()
-	if segCount <= 0 {
-		log.Fatalf("SegmentCount() returned %d", segCount)
+func newEncoder(w io.Writer) (*encoder, error) {
+	e := &encoder{info: screen.NewHexScreen()}
+	segments := e.info.SegmentCount()
+	if segments <= 0 {
+		return nil, fmt.Errorf("SegmentCount() returned %d", segments)
 	}
+	if text {
+		e.glyphs = segimage.FontGlyphs(font.GetFont())
+	}
+	e.levels = make([]float64, segments)
+	if raw {
+		e.out = segvideo.NewRawWriter(w, segments)
+		return e, nil
+	}
+	var err error
+	e.out, err = segvideo.NewWriter(w, segvideo.Header{
+		Bits:     bits,
+		Segments: segments,
+		FPS:      fps,
+		Gamma:    gamma,
+		Layout:   screen.LayoutHash(e.info),
+	})
+	return e, err
+}
 
-	positions := make([]int, segCount)
-
-	// Find bounding box of all segment coordinates
-	const big = 1e9
-	lx, ly := big, big
-	hx, hy := -big, -big
-
-	for i := 0; i < segCount; i++ {
-		c := hex.SegmentCoord(i)
-		if c.X < lx {
-			lx = c.X
-		}
-		if c.X > hx {
-			hx = c.X
-		}
-		if c.Y < ly {
-			ly = c.Y
-		}
-		if c.Y > hy {
-			hy = c.Y
+// encode converts one w×h frame, building the converter for its size when
+// it changes, and writes it count times.
+func (e *encoder) encode(pix []byte, w, h, count int) error {
+	if e.conv == nil {
+		e.conv = e.converter(w, h)
+	} else if cw, ch := e.conv.Size(); cw != w || ch != h {
+		e.conv = e.converter(w, h)
+	}
+	e.conv.Levels(pix, e.levels)
+	if text {
+		segimage.Text(e.levels, e.glyphs)
+	}
+	e.conv.Encode(e.levels, levels, dither)
+	for i := 0; i < count; i++ {
+		if err := e.out.WriteFrame(e.levels); err != nil {
+			return fmt.Errorf("writing output frame: %v", err)
 		}
 	}
+	return nil
+}
 
-	if hx <= lx || hy <= ly {
-		log.Fatalf("invalid segment coordinate bounds: lx=%f hx=%f ly=%f hy=%f", lx, hx, ly, hy)
+func (e *encoder) converter(w, h int) *segimage.Converter {
+	if sample == "point" {
+		return segimage.NewPointConverter(e.info, w, h, gamma)
 	}
+	return segimage.NewConverter(e.info, w, h, gamma)
+}
 
-	fx := float64(w-1) / (hx - lx)
-	fy := float64(h-1) / (hy - ly)
+func encodeImage(e *encoder, name string) error {
+	f, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	img, _, err := image.Decode(f)
+	if err != nil {
+		return fmt.Errorf("%s: %v", name, err)
+	}
+	pix, w, h := segimage.Gray(img)
+	return e.encode(pix, w, h, repeat)
+}
 
-	for i := 0; i < segCount; i++ {
-		// Skip the 16th segment in each digit (center/unused)
-		if i&0xF == 0xF {
-			positions[i] = -1
-			continue
-		}
+func main() {
+	flag.Parse()
 
-		c := hex.SegmentCoord(i)
+	if sample != "area" && sample != "point" {
+		log.Fatalf("invalid -sample %q: want area or point", sample)
+	}
+	if raw {
+		bits = 8
+	}
+	if bits != 8 && bits != 16 {
+		log.Fatalf("invalid -bits %d: want 8 or 16", bits)
+	}
+	if levels == 0 {
+		levels = 1 << uint(bits)
+	}
+	if levels < 2 || levels > 1<<uint(bits) {
+		log.Fatalf("invalid -levels %d: want 2 to %d", levels, 1<<uint(bits))
+	}
+	if text && dither {
+		// the error would spread into the segments the glyphs leave off
+		log.Fatal("-dither cannot be used with -text")
+	}
 
-		x := int((c.X - lx) * fx)
-		y := int((c.Y - ly) * fy)
+	e, err := newEncoder(os.Stdout)
+	if err != nil {
+		log.Fatal(err)
+	}
 
-		// Clamp to image bounds
-		if x < 0 {
-			x = 0
-		}
-		if x >= w {
-			x = w - 1
-		}
-		if y < 0 {
-			y = 0
+	if flag.NArg() > 0 {
+		for _, name := range flag.Args() {
+			if err := encodeImage(e, name); err != nil {
+				log.Fatal(err)
+			}
 		}
-		if y >= h {
-			y = h - 1
+		if err := e.out.Close(); err != nil {
+			log.Fatalf("writing output: %v", err)
 		}
-
-		positions[i] = x + y*w
+		return
 	}
 
-	return positions
-}
-
-func main() {
-	flag.Parse()
-
 	if width <= 0 || height <= 0 {
 		log.Fatalf("invalid dimensions: width=%d height=%d", width, height)
 	}
 
-	positions := buildPositions(width, height)
-
-	inFrameSize := width * height
-	inframe := make([]byte, inFrameSize)
-	outframe := make([]byte, len(positions))
+	inframe := make([]byte, width*height)
 
 	for {
 		_, err := io.ReadFull(os.Stdin, inframe)
@@ -119,17 +182,11 @@ func main() {
 			log.Fatalf("reading input frame: %v", err)
 		}
 
-		for i, p := range positions {
-			if p >= 0 && p < len(inframe) {
-				outframe[i] = inframe[p]
-			} else {
-				// Out-of-range or unused segment -> black
-				outframe[i] = 0
-			}
-		}
-
-		if _, err := os.Stdout.Write(outframe); err != nil {
-			log.Fatalf("writing output frame: %v", err)
+		if err := e.encode(inframe, width, height, 1); err != nil {
+			log.Fatal(err)
 		}
 	}
+	if err := e.out.Close(); err != nil {
+		log.Fatalf("writing output: %v", err)
+	}
 }
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"post6.net/gohexdump/internal/playlist"
+	"post6.net/gohexdump/internal/screen"
+	"post6.net/gohexdump/internal/store"
+)
+
+// fakeStore is an in-memory store.Store that records what it is given.
+type fakeStore struct {
+	mutex sync.Mutex
+	saved []string
+	err   error // returned by Save and Recent if set
+}
+
+func (s *fakeStore) Save(content string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.err != nil {
+		return s.err
+	}
+	s.saved = append(s.saved, content)
+	return nil
+}
+
+func (s *fakeStore) Recent(n int) ([]string, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.err != nil {
+		return nil, s.err
+	}
+	var out []string
+	for i := len(s.saved) - 1; i >= 0 && len(out) < n; i-- {
+		out = append(out, s.saved[i])
+	}
+	return out, nil
+}
+
+func (s *fakeStore) Saved() []string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return append([]string(nil), s.saved...)
+}
+
+var _ store.Store = (*fakeStore)(nil)
+
+// newTestDisplay returns a display with the default rain playlist, and a
+// screen channel that is drained in the background. Call the cleanup
+// function at the end of the test.
+func newTestDisplay(t *testing.T, st store.Store) (*display, chan<- screen.Screen, func()) {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "hexboard")
+	if err != nil {
+		t.Fatal(err)
+	}
+	idle, err := newIdlePlaylist(filepath.Join(dir, "playlist.toml"), defaultPlaylist(playlist.Rain), &idleBuilder{store: st})
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+	screens := make(chan screen.Screen)
+	done := make(chan struct{})
+	go func() {
+		for range screens {
+		}
+		close(done)
+	}()
+	return newDisplay(idle), screens, func() {
+		close(screens)
+		<-done
+		os.RemoveAll(dir)
+	}
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"post6.net/gohexdump/internal/screen"
+)
+
+// Editors mirror the text they are editing with a view on the cursor port:
+//
+//	TEXT <lines> <row> <col> [id]
+//	<line>
+//	...
+//
+// followed by exactly <lines> lines of text, normally the four around the
+// cursor. The cursor is on line <row> (0-based) at character <col>, with
+// tabs expanded. The board shows the lines from the left, scrolling
+// sideways to keep the cursor at least editMargin columns from either edge.
+//
+// Ranges such as the selection or search hits are highlighted with
+//
+//	MARKS <n>
+//	<kind> <row> <col> <len>
+//	...
+//
+// which sets the marks for the views that follow, in the same coordinates
+// as the cursor; kind is one of screen.HighlightNames. "MARKS 0" clears
+// them.
+//
+// There is one text layer, so with several editors connected the last one
+// to send a view wins: its lines, marks and sideways scroll are shown, and
+// the cursor of the editor it replaces is removed, as it would point into
+// text no longer on the board. That cursor comes back with its next view.
+const (
+	editMargin    = 4
+	maxEditLines  = 16
+	maxEditMarks  = 256
+	maxEditColumn = 4096 // bounds mark columns and lengths
+)
+
+// editorView is one view sent by an editor.
+type editorView struct {
+	id       string
+	lines    []string
+	row, col int
+}
+
+func isEditorView(line string) bool {
+	return strings.HasPrefix(strings.ToUpper(line), "TEXT ")
+}
+
+func isEditorMarks(line string) bool {
+	return strings.HasPrefix(strings.ToUpper(line), "MARKS ")
+}
+
+// readEditorMarks parses a MARKS header, just read by scanner, and reads
+// the marks that follow it.
+func readEditorMarks(scanner *bufio.Scanner) ([]screen.Mark, error) {
+	fields := strings.Fields(scanner.Text())
+	if len(fields) != 2 {
+		return nil, fmt.Errorf("usage: MARKS <n>")
+	}
+	n, err := strconv.Atoi(fields[1])
+	if err != nil || n < 0 || n > maxEditMarks {
+		return nil, fmt.Errorf("MARKS: want 0 to %d marks, got %q", maxEditMarks, fields[1])
+	}
+	marks := make([]screen.Mark, 0, n)
+	for len(marks) < n {
+		if !scanner.Scan() {
+			return nil, fmt.Errorf("MARKS: connection closed after %d of %d marks", len(marks), n)
+		}
+		var m screen.Mark
+		if _, err := fmt.Sscan(scanner.Text(), &m.Kind, &m.Row, &m.Column, &m.Len); err != nil {
+			return nil, fmt.Errorf("MARKS: want <kind> <row> <col> <len>, got %q", scanner.Text())
+		}
+		if _, err := screen.NewHighlight(m.Kind); err != nil {
+			return nil, fmt.Errorf("MARKS: %v", err)
+		}
+		if m.Row < 0 || m.Row >= maxEditLines || m.Column < 0 || m.Column > maxEditColumn ||
+			m.Len < 0 || m.Len > maxEditColumn {
+			return nil, fmt.Errorf("MARKS: want row 0 to %d, col and len 0 to %d, got %q",
+				maxEditLines-1, maxEditColumn, scanner.Text())
+		}
+		marks = append(marks, m)
+	}
+	return marks, nil
+}
+
+// readEditorView parses a TEXT header, just read by scanner, and reads the
+// lines that follow it.
+func readEditorView(scanner *bufio.Scanner) (*editorView, error) {
+	fields := strings.Fields(scanner.Text())[1:]
+	if len(fields) < 3 || len(fields) > 4 {
+		return nil, fmt.Errorf("usage: TEXT <lines> <row> <col> [id]")
+	}
+	var n [3]int
+	for i := range n {
+		var err error
+		if n[i], err = strconv.Atoi(fields[i]); err != nil || n[i] < 0 {
+			return nil, fmt.Errorf("TEXT: bad number %q", fields[i])
+		}
+	}
+	if n[0] > maxEditLines {
+		return nil, fmt.Errorf("TEXT: at most %d lines", maxEditLines)
+	}
+	v := &editorView{row: n[1], col: n[2]}
+	if len(fields) == 4 {
+		v.id = fields[3]
+	}
+	for len(v.lines) < n[0] {
+		if !scanner.Scan() {
+			return nil, fmt.Errorf("TEXT: connection closed after %d of %d lines", len(v.lines), n[0])
+		}
+		v.lines = append(v.lines, scanner.Text())
+	}
+	return v, nil
+}
+
+// showEditor mirrors an editor view, with marks, into the text layer and
+// moves the editor's cursor there. The text layer is shown as for a
+// message, and returns to idle after timeout without further views, but no
+// message events are published.
+func (d *display) showEditor(v *editorView, marks []screen.Mark, screenChan chan<- screen.Screen, timeout time.Duration) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	if !d.editing || v.id != d.editor {
+		if d.editing {
+			d.cursor.Expire(d.editor, 0)
+		}
+		d.editor = v.id
+		d.editScroll = 0
+	}
+
+	columns, rows := d.text.Size()
+	switch {
+	case v.col < d.editScroll+editMargin:
+		d.editScroll = v.col - editMargin
+		if d.editScroll < 0 {
+			d.editScroll = 0
+		}
+	case v.col >= d.editScroll+columns-editMargin:
+		d.editScroll = v.col - columns + editMargin + 1
+	}
+
+	d.text.Hold()
+	d.text.Clear()
+	for row, line := range v.lines {
+		if row >= rows {
+			break
+		}
+		runes := []rune(strings.ToUpper(strings.Replace(line, "\t", " ", -1)))
+		if d.editScroll >= len(runes) {
+			continue
+		}
+		runes = runes[d.editScroll:]
+		if len(runes) > columns {
+			runes = runes[:columns]
+		}
+		d.text.WriteAt(string(runes), 0, row)
+	}
+	shifted := make([]screen.Mark, len(marks))
+	for i, m := range marks {
+		m.Column -= d.editScroll
+		shifted[i] = m
+	}
+	screen.Highlight(d.text, shifted) // kinds were checked by readEditorMarks
+	d.text.Update()
+	d.cursor.SetCursorFor(v.id, v.col-d.editScroll, v.row, 0)
+
+	if d.mode != modeMessage || d.message != d.ripple {
+		d.message = d.ripple
+		d.show(screenChan, d.ripple)
+		d.mode = modeMessage
+	}
+	d.editing = true
+	d.arm(screenChan, timeout)
+	d.touch(screenChan)
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"bufio"
+	"reflect"
+	"strings"
+	"testing"
+
+	"post6.net/gohexdump/internal/screen"
+)
+
+// scan returns a scanner over text that has just read its first line, as
+// the cursor port has when it hands over to the parsers.
+func scan(t *testing.T, text string) *bufio.Scanner {
+	t.Helper()
+	scanner := bufio.NewScanner(strings.NewReader(text))
+	if !scanner.Scan() {
+		t.Fatal("no header")
+	}
+	return scanner
+}
+
+func TestReadEditorView(t *testing.T) {
+	s := scan(t, "text 2 1 5 vim-1\nfirst line\n\tsecond\nnot read\n")
+	if !isEditorView(s.Text()) {
+		t.Fatal("TEXT header not recognised")
+	}
+	v, err := readEditorView(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &editorView{id: "vim-1", lines: []string{"first line", "\tsecond"}, row: 1, col: 5}
+	if !reflect.DeepEqual(v, want) {
+		t.Errorf("view = %+v, want %+v", v, want)
+	}
+	if !s.Scan() || s.Text() != "not read" {
+		t.Errorf("parser read past its lines")
+	}
+
+	for _, text := range []string{
+		"TEXT 1 0",             // too few fields
+		"TEXT 1 0 0 id extra",  // too many
+		"TEXT x 0 0",           // not a number
+		"TEXT 1 -1 0",          // negative
+		"TEXT 17 0 0",          // more than maxEditLines
+		"TEXT 3 0 0\none\ntwo", // connection closed early
+	} {
+		if v, err := readEditorView(scan(t, text)); err == nil {
+			t.Errorf("%q: parsed %+v", text, v)
+		}
+	}
+}
+
+func TestReadEditorMarks(t *testing.T) {
+	s := scan(t, "MARKS 2\ninvert 0 3 4\nunderline 2 0 10\n")
+	if !isEditorMarks(s.Text()) {
+		t.Fatal("MARKS header not recognised")
+	}
+	marks, err := readEditorMarks(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []screen.Mark{{Kind: "invert", Row: 0, Column: 3, Len: 4}, {Kind: "underline", Row: 2, Column: 0, Len: 10}}
+	if !reflect.DeepEqual(marks, want) {
+		t.Errorf("marks = %+v, want %+v", marks, want)
+	}
+
+	if marks, err := readEditorMarks(scan(t, "MARKS 0")); err != nil || len(marks) != 0 {
+		t.Errorf("MARKS 0 = %v, %v, want no marks", marks, err)
+	}
+
+	for _, text := range []string{
+		"MARKS",                                    // no count
+		"MARKS -1",                                 // negative count
+		"MARKS 257",                                // more than maxEditMarks
+		"MARKS 1\nsparkle 0 0 1",                   // unknown kind
+		"MARKS 1\ninvert 0 0",                      // too few fields
+		"MARKS 1\ninvert -1 0 1",                   // negative row
+		"MARKS 1\ninvert 16 0 1",                   // row past maxEditLines
+		"MARKS 1\ninvert 0 -2000000000 1",          // negative column
+		"MARKS 1\ninvert 0 0 -1",                   // negative length
+		"MARKS 1\ninvert 0 0 2000000010",           // absurd length
+		"MARKS 1\ninvert 0 99999999999 1",          // absurd column
+		"MARKS 1\ninvert 0 0 99999999999999999999", // overflows int
+		"MARKS 2\ninvert 0 0 1",                    // connection closed early
+	} {
+		if marks, err := readEditorMarks(scan(t, text)); err == nil {
+			t.Errorf("%q: parsed %+v", text, marks)
+		}
+	}
+}
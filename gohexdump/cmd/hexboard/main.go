@@ -6,14 +6,22 @@ import (
 	"fmt"
 	"log"
 	"net"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
+	"post6.net/gohexdump/internal/brightness"
 	"post6.net/gohexdump/internal/drivers"
+	"post6.net/gohexdump/internal/events"
 	"post6.net/gohexdump/internal/font"
 	"post6.net/gohexdump/internal/hue"
+	"post6.net/gohexdump/internal/metrics"
+	"post6.net/gohexdump/internal/playlist"
 	"post6.net/gohexdump/internal/screen"
 	"post6.net/gohexdump/internal/store"
+	"post6.net/gohexdump/internal/tcpserver"
+	"post6.net/gohexdump/internal/webhook"
 )
 
 var hexConf = screen.Configuration{
@@ -28,86 +36,448 @@ func identityTransform(v screen.Vector2) screen.Vector2 { return v }
 
 // display holds the two long-lived screen objects and the shared cursor.
 //
-//   rain   — matrix raindrop animation shown when idle
+//   rain   — idle screen: the playlist rotation (raindrops by default)
 //   ripple — rectripple screen used when a message is displayed;
 //            text is written into its text layer on each message
-//   cursor — shared RippleCursor; editor updates always go here
+//   big    — huge characters, for messages sent with BIG
+//   cursor — a RippleCursor per editor client, plus the shared one
+//   timers — named countdowns and stopwatches, shown while any run
+//   brightness — global output level: day/night schedule and overrides
+//
+// With blankAfter set, the board fades to black once there has been no
+// input for that long, and fades back in on the next input.
 type display struct {
-	rain    screen.Screen
-	ripple  screen.Screen
-	text    screen.TextScreen
-	cursor  screen.Cursor
-	hueConf *hue.Config // nil when Hue is disabled
-}
-
-func newDisplay() *display {
-	// Idle: matrix rain
-	hex := screen.NewHexScreen()
-	hex.SetFont(font.GetFont())
-	rain := screen.NewFilterScreen(hex, []screen.Filter{
-		screen.NewRaindropFilter(hex),
-		screen.DefaultGamma(),
-	})
+	rain      screen.Screen
+	playlist  *idlePlaylist
+	ripple    screen.Screen
+	big       *screen.BigText
+	bigScreen screen.Screen
+	text      screen.TextScreen
+	cursor    *screen.CursorSet
+	timers    *timerBoard
+	bus       *events.Bus // message shown / expired / idle, for integrations
+
+	brightness *brightness.Controller
+	output     *screen.BrightnessControl
+
+	mutex   sync.Mutex
+	seq     uint64        // incremented per message; only the latest may expire
+	mode    string        // modeRain, modeMessage or modeTimer
+	prev    string        // mode to return to when the timers are done
+	last    string        // last message shown, without markup
+	message screen.Screen // ripple or bigScreen, whichever shows last
+
+	editing    bool   // the text layer holds an editor view, not a message
+	editScroll int    // first editor column on the board
+	editor     string // id of the editor whose view is shown
+
+	blankAfter time.Duration // 0: only blank on request
+	blanked    bool
+	current    screen.Screen // screen shown, or to wake into while blanked
+	active     time.Time     // last input
+}
+
+// How fast the board fades out when blanking and back in on input.
+const (
+	blankFade = 3 * time.Second
+	wakeFade  = 500 * time.Millisecond
+)
+
+// transitionTimes is how long each -transition takes per change: a whole
+// change for fade and fall, one flap for flap.
+var transitionTimes = map[screen.GlyphTransition]time.Duration{
+	screen.FadeTransition: 300 * time.Millisecond,
+	screen.FallTransition: 500 * time.Millisecond,
+	screen.FlapTransition: 60 * time.Millisecond,
+}
+
+// Display modes. modeRain is the idle mode whatever -idle shows; the name
+// is kept for the TCP and MQTT protocols.
+const (
+	modeRain    = "rain"
+	modeMessage = "message"
+	modeTimer   = "timer"
+)
+
+// newIdleScreen builds a rain or clock idle screen: raindrops, a clock, or
+// a clock layered over the raindrops.
+func newIdleScreen(idle string, clock screen.ClockOptions) (screen.Screen, error) {
+	switch idle {
+	case playlist.Rain:
+		hex := screen.NewHexScreen()
+		hex.SetFont(font.GetFont())
+		return screen.NewFilterScreen(hex, []screen.Filter{
+			screen.NewRaindropFilter(hex),
+			screen.DefaultGamma(),
+		}), nil
+	case playlist.Clock, playlist.RainClock:
+		s := screen.NewTextScreen(hexConf)
+		s.SetFont(font.GetFont())
+		ripple := screen.NewRippleFilter(.3, nil, identityTransform, s)
+		c := screen.NewClock(s, ripple, clock)
+		if idle == playlist.Clock {
+			return screen.NewFilterScreen(c, []screen.Filter{
+				ripple,
+				screen.DefaultGamma(),
+				screen.NewAfterGlowFilter(.85),
+			}), nil
+		}
+		return screen.NewFilterScreen(s, []screen.Filter{
+			screen.NewRaindropFilter(s),
+			c,
+			ripple,
+			screen.DefaultGamma(),
+		}), nil
+	}
+	return nil, fmt.Errorf("unknown idle screen %q (want %s, %s or %s)", idle, playlist.Rain, playlist.Clock, playlist.RainClock)
+}
+
+func newDisplay(idle *idlePlaylist) *display {
 
 	// Text display: rectripple with cursor
 	s := screen.NewTextScreen(hexConf)
 	s.SetFont(font.GetFont())
 	s.SetStyle(screen.NewBrightness(1))
-	cursor := screen.NewRippleCursor(1, .5, nil, identityTransform, s)
+	cursor := screen.NewCursorSet(func(brightness float64) screen.Cursor {
+		return screen.NewRippleCursor(brightness, .5, nil, identityTransform, s)
+	})
 	ripple := screen.NewFilterScreen(s, []screen.Filter{
 		cursor,
 		screen.DefaultGamma(),
 		screen.NewAfterGlowFilter(.85),
 	})
 
-	return &display{rain: rain, ripple: ripple, text: s, cursor: cursor}
+	big := screen.NewBigText(s, 1)
+	d := &display{
+		rain:     idle.rotator,
+		playlist: idle,
+		ripple:   ripple,
+		big:      big,
+		bigScreen: screen.NewFilterScreen(big, []screen.Filter{
+			screen.DefaultGamma(),
+			screen.NewAfterGlowFilter(.85),
+		}),
+		message: ripple,
+		text:    s,
+		cursor:  cursor,
+		timers:  newTimerBoard(),
+		bus:     new(events.Bus),
+		mode:    modeRain,
+		output:  screen.NewBrightnessControl(1),
+		active:  time.Now(),
+	}
+	d.current = d.rain
+	d.timers.done = func(name string) {
+		d.bus.Publish(events.Event{Type: events.TimerDone, Message: name})
+	}
+	return d
 }
 
-// showMessage writes msg into the rectripple text layer, switches to it,
-// then returns to rain after timeout. Safe to call from multiple goroutines.
+// state returns the current mode and last message.
+func (d *display) state() (mode, last string) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	return d.mode, d.last
+}
+
+// showMessage writes msg, with style markup (see screen.ParseMarkup), into
+// the rectripple text layer, switches to it, then returns to rain once
+// timeout has passed without a newer message.
+// Safe to call from multiple goroutines.
 func (d *display) showMessage(msg string, screenChan chan<- screen.Screen, timeout time.Duration) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	columns, rows := d.text.Size()
+	runes, styles := screen.ParseMarkup(strings.ToUpper(msg), d.text)
+	d.text.Hold()
 	d.text.Clear()
-	for row, line := range strings.SplitN(strings.ToUpper(msg), "\n", 4) {
-		runes := []rune(line)
-		if len(runes) > 32 {
-			runes = runes[:32]
+	col, row := 0, 0
+	for i, r := range runes {
+		if r == '\n' {
+			col, row = 0, row+1
+			continue
 		}
-		d.text.WriteAt(string(runes), 0, row)
-	}
-	screenChan <- d.ripple
-	if d.hueConf != nil {
-		go d.hueConf.TurnOn()
+		if row >= rows {
+			break
+		}
+		if col < columns {
+			d.text.WriteAt(string(r), col, row)
+			if styles[i] != nil {
+				d.text.SetStyleAt(styles[i], col, row)
+			}
+		}
+		col++
 	}
+	d.text.Update()
+	// events, MQTT, webhooks and Hue get the text as shown; the history
+	// keeps the markup, so that messages are re-sent as styled
+	d.last = screen.StripMarkup(msg)
+	d.message = d.ripple
+	d.activate(screenChan, timeout)
+	d.touch(screenChan)
+}
+
+// showBig shows msg in huge characters, scrolling if it is too long, like
+// a message otherwise.
+func (d *display) showBig(msg string, screenChan chan<- screen.Screen, timeout time.Duration) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	d.last = screen.StripMarkup(msg)
+	d.big.SetText(strings.Replace(d.last, "\n", " ", -1))
+	d.message = d.bigScreen
+	d.activate(screenChan, timeout)
+	d.touch(screenChan)
+}
+
+// wake switches to the text layer without changing its contents, as if
+// the last message had just arrived.
+func (d *display) wake(screenChan chan<- screen.Screen, timeout time.Duration) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	d.activate(screenChan, timeout)
+	d.touch(screenChan)
+}
+
+// activate shows the last message, in the text layer or big, and arms the
+// return-to-rain timer.
+// Must be called with d.mutex held.
+func (d *display) activate(screenChan chan<- screen.Screen, timeout time.Duration) {
+	d.show(screenChan, d.message)
+	d.mode = modeMessage
+	d.editing = false
+	d.bus.Publish(events.Event{Type: events.MessageShown, Message: d.last})
+	d.arm(screenChan, timeout)
+}
+
+// arm (re)starts the return-to-rain timer for the text layer.
+// Must be called with d.mutex held.
+func (d *display) arm(screenChan chan<- screen.Screen, timeout time.Duration) {
+	d.seq++
+	seq := d.seq
 	go func() {
 		time.Sleep(timeout)
-		screenChan <- d.rain
+		d.mutex.Lock()
+		defer d.mutex.Unlock()
+		if d.seq != seq {
+			return // a newer message owns the screen
+		}
+		if !d.editing {
+			d.bus.Publish(events.Event{Type: events.MessageExpired, Message: d.last})
+		}
+		if d.timers.active() {
+			d.prev = modeRain
+			d.showTimersLocked(screenChan)
+			return
+		}
+		d.idle(screenChan)
 	}()
 }
 
-func tcpListener(port string, screenChan chan<- screen.Screen, d *display, timeout time.Duration) {
-	listen, err := net.Listen("tcp", "0.0.0.0:"+port)
-	if err != nil {
+// clear blanks the text layer and the big text without changing mode.
+func (d *display) clear(screenChan chan<- screen.Screen) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	d.text.Clear()
+	d.text.Update()
+	d.big.SetText("")
+	d.touch(screenChan)
+}
+
+// setStyle sets the style for the current and all following messages.
+func (d *display) setStyle(style screen.Style, screenChan chan<- screen.Screen) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	d.touch(screenChan)
+	d.text.SetStyle(style)
+	d.text.Hold()
+	columns, rows := d.text.Size()
+	for row := 0; row < rows; row++ {
+		for col := 0; col < columns; col++ {
+			d.text.SetStyleAt(style, col, row)
+		}
+	}
+	d.text.Update()
+}
+
+// showRain returns to the idle rain immediately, cancelling any pending
+// message timer.
+func (d *display) showRain(screenChan chan<- screen.Screen) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	d.seq++
+	d.idle(screenChan)
+	d.touch(screenChan)
+}
+
+// idle switches to rain. Must be called with d.mutex held.
+func (d *display) idle(screenChan chan<- screen.Screen) {
+	d.show(screenChan, d.rain)
+	if d.mode != modeRain {
+		d.mode = modeRain
+		d.bus.Publish(events.Event{Type: events.Idle})
+	}
+}
+
+// startTimer starts or restarts a named countdown (a stopwatch if dur is 0)
+// and switches to the timers. When the last timer is done the board goes
+// back to what it showed before: idle, or the last message for timeout.
+func (d *display) startTimer(name string, dur time.Duration, screenChan chan<- screen.Screen, timeout time.Duration) error {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	d.timers.onEmpty(func() { d.timersDone(screenChan, timeout) })
+	if err := d.timers.start(name, dur); err != nil {
+		return err
+	}
+	d.bus.Publish(events.Event{Type: events.TimerStarted, Message: strings.ToUpper(name)})
+	if d.mode != modeTimer {
+		d.prev = d.mode
+		d.showTimersLocked(screenChan)
+	}
+	d.touch(screenChan)
+	return nil
+}
+
+// stopTimer removes a timer; the board leaves the timers once none remain.
+func (d *display) stopTimer(name string) error {
+	return d.timers.stop(name)
+}
+
+// showTimers switches to the running timers, if there are any.
+func (d *display) showTimers(screenChan chan<- screen.Screen) error {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	if !d.timers.active() {
+		return fmt.Errorf("no timers running")
+	}
+	if d.mode != modeTimer {
+		d.prev = d.mode
+		d.showTimersLocked(screenChan)
+	}
+	d.touch(screenChan)
+	return nil
+}
+
+// showTimersLocked shows the timers and cancels any pending message
+// timeout. Must be called with d.mutex held.
+func (d *display) showTimersLocked(screenChan chan<- screen.Screen) {
+	d.seq++
+	d.show(screenChan, d.timers.screen)
+	d.mode = modeTimer
+}
+
+// timersDone returns from the timers to the previous mode.
+func (d *display) timersDone(screenChan chan<- screen.Screen, timeout time.Duration) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	if d.mode != modeTimer || d.timers.active() {
 		return
 	}
-	defer listen.Close()
-	for {
-		conn, err := listen.Accept()
-		if err != nil {
-			continue
+	if d.prev == modeMessage {
+		d.activate(screenChan, timeout)
+	} else {
+		d.idle(screenChan)
+	}
+}
+
+// cursorTTL is how long the cursor of a web or MQTT client stays up
+// without moving; cursor port clients keep theirs until cursorGrace after
+// they disconnect.
+const (
+	cursorTTL   = 5 * time.Minute
+	cursorGrace = 10 * time.Second
+)
+
+// moveCursor moves the cursor of client id ("" for the shared cursor), see
+// screen.CursorSet. Like any input, it wakes the board.
+func (d *display) moveCursor(id string, col, row int, ttl time.Duration, screenChan chan<- screen.Screen) {
+	d.cursor.SetCursorFor(id, col, row, ttl)
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	d.touch(screenChan)
+}
+
+// show switches the board to s or, while it is blanked, makes s the screen
+// to wake into. Must be called with d.mutex held.
+func (d *display) show(screenChan chan<- screen.Screen, s screen.Screen) {
+	d.current = s
+	if !d.blanked {
+		screenChan <- s
+	}
+}
+
+// touch records input, fading the board back in if it is blanked.
+// Must be called with d.mutex held.
+func (d *display) touch(screenChan chan<- screen.Screen) {
+	d.active = time.Now()
+	if d.blanked {
+		d.blanked = false
+		screenChan <- screen.NewCrossfade(screen.Blank, d.current, wakeFade)
+		d.bus.Publish(events.Event{Type: events.Wake})
+	}
+}
+
+// blank fades the board out until the next input.
+func (d *display) blank(screenChan chan<- screen.Screen) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	d.blankLocked(screenChan)
+}
+
+// unblank fades the board back in, as any input would.
+func (d *display) unblank(screenChan chan<- screen.Screen) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	d.touch(screenChan)
+}
+
+// blankLocked fades the board out. Must be called with d.mutex held.
+func (d *display) blankLocked(screenChan chan<- screen.Screen) {
+	if d.blanked {
+		return
+	}
+	d.blanked = true
+	screenChan <- screen.NewCrossfade(d.current, screen.Blank, blankFade)
+	d.bus.Publish(events.Event{Type: events.Blank})
+}
+
+// BlankState is the blanking state reported by the API.
+type BlankState struct {
+	Blanked bool    `json:"blanked"`
+	Idle    float64 `json:"idle"`            // seconds since the last input
+	After   float64 `json:"after,omitempty"` // seconds of no input before blanking
+}
+
+func (d *display) blankState() BlankState {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	return BlankState{
+		Blanked: d.blanked,
+		Idle:    time.Since(d.active).Seconds(),
+		After:   d.blankAfter.Seconds(),
+	}
+}
+
+// watchBlank blanks the board once there has been no input for
+// d.blankAfter. Running timers keep it awake.
+func (d *display) watchBlank(screenChan chan<- screen.Screen) {
+	for range time.Tick(time.Second) {
+		d.mutex.Lock()
+		if d.mode != modeTimer && time.Since(d.active) >= d.blankAfter {
+			d.blankLocked(screenChan)
 		}
-		go func(conn net.Conn) {
-			defer conn.Close()
-			scanner := bufio.NewScanner(conn)
-			if scanner.Scan() {
-				d.showMessage(scanner.Text(), screenChan, timeout)
-			}
-		}(conn)
+		d.mutex.Unlock()
 	}
 }
 
 // cursorListener accepts persistent TCP connections and reads "col row\n"
 // lines to update the cursor position in real time (e.g. from an editor).
-func cursorListener(port string, cursor screen.Cursor) {
+// Each connection has its own cursor, removed soon after it disconnects; a line
+// "col row id" moves the cursor of client id instead, so that a client
+// keeps its cursor (and its brightness) across reconnects. Editors may
+// also send their view, see readEditorView.
+func cursorListener(port string, d *display, screenChan chan<- screen.Screen, timeout time.Duration) {
 	listen, err := net.Listen("tcp", "0.0.0.0:"+port)
 	if err != nil {
 		return
@@ -119,55 +489,199 @@ func cursorListener(port string, cursor screen.Cursor) {
 			continue
 		}
 		go func(conn net.Conn) {
-			defer conn.Close()
+			ids := make(map[string]bool)
+			var marks []screen.Mark
+			defer func() {
+				conn.Close()
+				for id := range ids {
+					d.cursor.Expire(id, cursorGrace)
+				}
+			}()
 			scanner := bufio.NewScanner(conn)
 			for scanner.Scan() {
-				var col, row int
-				if _, err := fmt.Sscan(scanner.Text(), &col, &row); err == nil {
-					cursor.SetCursor(col, row)
+				if isEditorMarks(scanner.Text()) {
+					m, err := readEditorMarks(scanner)
+					if err != nil {
+						log.Printf("cursor: %s: %v", conn.RemoteAddr(), err)
+						return
+					}
+					marks = m
+					continue
+				}
+				if isEditorView(scanner.Text()) {
+					v, err := readEditorView(scanner)
+					if err != nil {
+						log.Printf("cursor: %s: %v", conn.RemoteAddr(), err)
+						return
+					}
+					if v.id == "" {
+						v.id = conn.RemoteAddr().String()
+					}
+					ids[v.id] = true
+					messagesReceived.With(inputCursor).Inc()
+					d.showEditor(v, marks, screenChan, timeout)
+					continue
 				}
+				col, row, id, ok := parseCursor(scanner.Text())
+				if !ok {
+					continue
+				}
+				if id == "" {
+					id = conn.RemoteAddr().String()
+				}
+				ids[id] = true
+				messagesReceived.With(inputCursor).Inc()
+				d.moveCursor(id, col, row, 0, screenChan)
 			}
 		}(conn)
 	}
 }
 
+// parseCursor parses "col row" or "col row id".
+func parseCursor(line string) (col, row int, id string, ok bool) {
+	fields := strings.Fields(line)
+	if len(fields) < 2 || len(fields) > 3 {
+		return 0, 0, "", false
+	}
+	col, errCol := strconv.Atoi(fields[0])
+	row, errRow := strconv.Atoi(fields[1])
+	if errCol != nil || errRow != nil {
+		return 0, 0, "", false
+	}
+	if len(fields) == 3 {
+		id = fields[2]
+	}
+	return col, row, id, true
+}
+
 func main() {
 	port       := flag.String("port", "8080", "TCP port for text messages")
 	webport    := flag.String("webport", "80", "HTTP port for web interface")
 	cursorport := flag.String("cursorport", "8082", "TCP port for cursor position updates (col row\\n)")
 	timeout    := flag.Duration("timeout", 30*time.Second, "time to show message before returning to idle")
+	mqttBroker := flag.String("mqtt", "", "MQTT broker URL, e.g. tcp://localhost:1883 (empty disables MQTT)")
+	mqttPrefix := flag.String("mqtt-prefix", "hexboard", "MQTT topic prefix")
+	dbPath     := flag.String("db", store.DefaultPath, "message history database (\":memory:\" for no persistence)")
+	idle       := flag.String("idle", playlist.Rain, "idle screen without a playlist: rain, clock, rain+clock (clock layered over rain), plasma or recent")
+	clockDate  := flag.Bool("clock-date", false, "show the date next to the clock")
+	clockWeek  := flag.Bool("clock-week", false, "show the ISO week number next to the clock")
+	clockZones := flag.String("clock-zones", "", "extra clock rows, e.g. \"NYC=America/New_York,SYD=Australia/Sydney\"")
+	blankAfter := flag.Duration("blank", 0, "fade the board out after this long without input, e.g. 15m (0 disables)")
+	transition := flag.String("transition", "none", "how message characters change: none, fade, fall or flap (split-flap)")
 	flag.Parse()
 
+	zones, err := screen.ParseClockZones(*clockZones)
+	if err != nil {
+		log.Fatalf("clock: %v", err)
+	}
+	glyphTransition, err := screen.NamedGlyphTransition(*transition)
+	if err != nil {
+		log.Fatalf("transition: %v (want %s)", err, strings.Join(screen.GlyphTransitionNames(), ", "))
+	}
 	refScreen := screen.NewHexScreen()
 	refScreen.SetFont(font.GetFont())
 
-	db, err := store.OpenDB()
+	db, err := store.Open(*dbPath)
 	if err != nil {
 		log.Fatalf("store: open DB: %v", err)
 	}
 
+	builder := &idleBuilder{
+		clock: screen.ClockOptions{Date: *clockDate, Week: *clockWeek, Zones: zones},
+		store: db,
+	}
+	idleScreens, err := newIdlePlaylist(playlist.ConfigPath, defaultPlaylist(*idle), builder)
+	if err != nil {
+		log.Printf("playlist: %v — showing -idle %s until it is fixed", err, *idle)
+		idleScreens, err = playIdlePlaylist(playlist.ConfigPath, defaultPlaylist(*idle), builder)
+		if err != nil {
+			log.Fatalf("playlist: %v", err)
+		}
+	}
+
 	hueCfg, err := hue.LoadConfig()
 	if err != nil {
 		log.Printf("hue: config error: %v — Hue disabled", err)
 		hueCfg = nil
 	}
 	if hueCfg != nil {
-		log.Printf("hue: enabled (bridge=%s device=%s)", hueCfg.BridgeIP, hueCfg.DeviceID)
+		log.Printf("hue: enabled (bridge=%s device=%s api=v%d)", hueCfg.BridgeIP, hueCfg.DeviceID, hueCfg.APIVersion)
 	} else {
 		log.Printf("hue: disabled (no config or config error)")
 	}
 
-	d := newDisplay()
-	d.hueConf = hueCfg
+	hooks, err := webhook.LoadConfig()
+	if err != nil {
+		log.Printf("webhook: config error: %v — webhooks disabled", err)
+		hooks = nil
+	}
+
+	brightCfg, err := brightness.LoadConfig()
+	if err != nil {
+		log.Printf("brightness: config error: %v — schedule disabled", err)
+		brightCfg = nil
+	}
+
+	d := newDisplay(idleScreens)
+	d.text.SetTransition(glyphTransition, transitionTimes[glyphTransition])
+	d.blankAfter = *blankAfter
+	d.brightness = brightness.NewController(brightCfg, d.output)
+	go d.brightness.Run()
 	d.cursor.SetCursor(0, 0)
+	metrics.NewGaugeFunc("hexboard_event_queue_depth",
+		"Events queued for integrations (Hue, MQTT, webhooks) but not yet handled.",
+		func() float64 { return float64(d.bus.Depth()) })
+	metrics.NewGaugeFunc("hexboard_brightness",
+		"Current output brightness level, 0 to 1 (before gamma).",
+		func() float64 { level, _ := d.output.Level(); return level })
+	metrics.NewGaugeFunc("hexboard_cursor_clients",
+		"Editor clients with a cursor on the board.",
+		func() float64 { return float64(d.cursor.Clients()) })
+	metrics.NewGaugeFunc("hexboard_blanked",
+		"1 while the board is blanked after inactivity, else 0.",
+		func() float64 {
+			if d.blankState().Blanked {
+				return 1
+			}
+			return 0
+		})
+	if hueCfg != nil {
+		hueCfg.Subscribe(d.bus)
+	}
+	if hooks != nil {
+		log.Printf("webhook: %d hook(s) enabled", len(hooks.Hooks))
+		hooks.Subscribe(d.bus)
+	}
 
 	multi, screenChan := screen.NewMultiScreen()
 	screenChan <- d.rain
 
-	go tcpListener(*port, screenChan, d, *timeout)
-	go cursorListener(*cursorport, d.cursor)
+	go func() {
+		h := &tcpHandler{screenChan: screenChan, d: d, timeout: *timeout}
+		if err := tcpserver.ListenAndServe("0.0.0.0:"+*port, h); err != nil {
+			log.Printf("tcp: %v", err)
+		}
+	}()
+	go cursorListener(*cursorport, d, screenChan, *timeout)
+	if d.blankAfter > 0 {
+		go d.watchBlank(screenChan)
+	}
+	if hueCfg != nil {
+		go hueCfg.Watch(func(t hue.Trigger) {
+			messagesReceived.With(inputHue).Inc()
+			if t.Message != "" {
+				d.showMessage(t.Message, screenChan, *timeout)
+			} else {
+				d.wake(screenChan, *timeout)
+			}
+		})
+	}
+	if *mqttBroker != "" {
+		startMQTT(*mqttBroker, *mqttPrefix, screenChan, d, *timeout, db)
+	}
 	go startWebServer(":"+*webport, screenChan, d, *timeout, db)
 
 	q := make(chan bool)
-	screen.DisplayRoutine(drivers.GetDriver(refScreen.SegmentCount()), multi, refScreen, q)
+	out := screen.NewFilterScreen(multi, []screen.Filter{d.output})
+	screen.DisplayRoutine(drivers.GetDriver(refScreen.SegmentCount()), out, refScreen, q)
 }
@@ -0,0 +1,23 @@
+package main
+
+import (
+	"post6.net/gohexdump/internal/metrics"
+)
+
+// Input names used as the "input" label of messagesReceived.
+const (
+	inputTCP    = "tcp"
+	inputWeb    = "web"
+	inputMQTT   = "mqtt"
+	inputHue    = "hue"
+	inputCursor = "cursor"
+)
+
+var (
+	messagesReceived = metrics.NewCounterVec("hexboard_messages_received_total",
+		"Messages and cursor updates received, by input.",
+		"input", inputTCP, inputWeb, inputMQTT, inputHue, inputCursor)
+	storeErrors = metrics.NewCounterVec("hexboard_store_errors_total",
+		"Failed message store operations, by operation.",
+		"op", "save", "recent")
+)
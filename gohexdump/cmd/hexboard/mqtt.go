@@ -0,0 +1,173 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+
+	"post6.net/gohexdump/internal/events"
+	"post6.net/gohexdump/internal/screen"
+	"post6.net/gohexdump/internal/store"
+)
+
+// MQTT topics, relative to the -mqtt-prefix:
+//
+//	message/set  (in)  payload is shown like a web/TCP message and stored
+//	big/set      (in)  payload is shown in huge characters and stored
+//	cursor/set   (in)  "col row", same as the cursor port; "col row id" moves
+//	                   the cursor of client id, which lasts cursorTTL
+//	mode/set     (in)  "rain", "message" (re-shows the last message) or
+//	                   "timer" (shows running timers)
+//	mode         (out, retained)  current mode: "rain", "message" or "timer"
+//	message      (out, retained)  last message shown
+//	power        (out, retained)  "off" while blanked after inactivity, else "on"
+//	status       (out, retained)  "online", or "offline" via last will
+const (
+	topicMessageSet = "message/set"
+	topicBigSet     = "big/set"
+	topicCursorSet  = "cursor/set"
+	topicModeSet    = "mode/set"
+	topicMode       = "mode"
+	topicMessage    = "message"
+	topicPower      = "power"
+	topicStatus     = "status"
+)
+
+type mqttBridge struct {
+	client     mqtt.Client
+	prefix     string
+	screenChan chan<- screen.Screen
+	d          *display
+	timeout    time.Duration
+	store      store.Store
+}
+
+// startMQTT connects to broker (e.g. "tcp://localhost:1883") and keeps the
+// connection up in the background. Subscriptions are (re)made on every
+// connect, and board state is published retained whenever it changes.
+func startMQTT(broker, prefix string, screenChan chan<- screen.Screen, d *display, timeout time.Duration, st store.Store) {
+	b := &mqttBridge{
+		prefix:     strings.TrimRight(prefix, "/"),
+		screenChan: screenChan,
+		d:          d,
+		timeout:    timeout,
+		store:      st,
+	}
+
+	host, _ := os.Hostname()
+	opts := mqtt.NewClientOptions().
+		AddBroker(broker).
+		SetClientID(fmt.Sprintf("hexboard-%s-%d", host, os.Getpid())).
+		SetAutoReconnect(true).
+		SetConnectRetry(true).
+		SetConnectRetryInterval(5*time.Second).
+		SetWill(b.topic(topicStatus), "offline", 1, true).
+		SetOnConnectHandler(b.onConnect).
+		SetConnectionLostHandler(func(_ mqtt.Client, err error) {
+			log.Printf("mqtt: connection lost: %v", err)
+		})
+	b.client = mqtt.NewClient(opts)
+	b.client.Connect()
+	b.watch(d.bus)
+}
+
+// watch publishes board state as it changes on bus.
+func (b *mqttBridge) watch(bus *events.Bus) {
+	bus.Subscribe(func(e events.Event) {
+		switch e.Type {
+		case events.MessageShown:
+			b.publishState(modeMessage, e.Message)
+		case events.Idle, events.TimerStarted:
+			b.publishState(b.d.state())
+		case events.Blank, events.Wake:
+			b.publishPower(e.Type == events.Blank)
+		}
+	})
+}
+
+func (b *mqttBridge) topic(t string) string {
+	return b.prefix + "/" + t
+}
+
+func (b *mqttBridge) onConnect(c mqtt.Client) {
+	log.Printf("mqtt: connected")
+	c.Publish(b.topic(topicStatus), 1, true, "online")
+	b.publishState(b.d.state())
+	b.publishPower(b.d.blankState().Blanked)
+	c.Subscribe(b.topic(topicMessageSet), 1, b.onMessage)
+	c.Subscribe(b.topic(topicBigSet), 1, b.onBig)
+	c.Subscribe(b.topic(topicCursorSet), 0, b.onCursor)
+	c.Subscribe(b.topic(topicModeSet), 1, b.onMode)
+}
+
+// publishState publishes the retained board state; it does not wait for the
+// broker.
+func (b *mqttBridge) publishState(mode, last string) {
+	b.client.Publish(b.topic(topicMode), 1, true, mode)
+	b.client.Publish(b.topic(topicMessage), 1, true, last)
+}
+
+// publishPower publishes the retained power state.
+func (b *mqttBridge) publishPower(blanked bool) {
+	power := "on"
+	if blanked {
+		power = "off"
+	}
+	b.client.Publish(b.topic(topicPower), 1, true, power)
+}
+
+func (b *mqttBridge) onMessage(_ mqtt.Client, m mqtt.Message) {
+	msg := string(m.Payload())
+	if msg == "" {
+		return
+	}
+	messagesReceived.With(inputMQTT).Inc()
+	if err := b.store.Save(msg); err != nil {
+		storeErrors.With("save").Inc()
+		log.Printf("store: save failed: %v", err)
+	}
+	b.d.showMessage(msg, b.screenChan, b.timeout)
+}
+
+func (b *mqttBridge) onBig(_ mqtt.Client, m mqtt.Message) {
+	msg := string(m.Payload())
+	if msg == "" {
+		return
+	}
+	messagesReceived.With(inputMQTT).Inc()
+	if err := b.store.Save(msg); err != nil {
+		storeErrors.With("save").Inc()
+		log.Printf("store: save failed: %v", err)
+	}
+	b.d.showBig(msg, b.screenChan, b.timeout)
+}
+
+func (b *mqttBridge) onCursor(_ mqtt.Client, m mqtt.Message) {
+	if col, row, id, ok := parseCursor(string(m.Payload())); ok {
+		ttl := time.Duration(0)
+		if id != "" {
+			ttl = cursorTTL
+		}
+		messagesReceived.With(inputCursor).Inc()
+		b.d.moveCursor(id, col, row, ttl, b.screenChan)
+	}
+}
+
+func (b *mqttBridge) onMode(_ mqtt.Client, m mqtt.Message) {
+	switch strings.TrimSpace(string(m.Payload())) {
+	case modeRain:
+		b.d.showRain(b.screenChan)
+	case modeMessage:
+		b.d.wake(b.screenChan, b.timeout)
+	case modeTimer:
+		if err := b.d.showTimers(b.screenChan); err != nil {
+			log.Printf("mqtt: %s: %v", m.Topic(), err)
+		}
+	default:
+		log.Printf("mqtt: %s: unknown mode %q", m.Topic(), m.Payload())
+	}
+}
@@ -0,0 +1,230 @@
+package main
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+)
+
+// doneToken is a completed mqtt.Token.
+type doneToken struct{}
+
+func (doneToken) Wait() bool                     { return true }
+func (doneToken) WaitTimeout(time.Duration) bool { return true }
+func (doneToken) Error() error                   { return nil }
+
+func (doneToken) Done() <-chan struct{} {
+	c := make(chan struct{})
+	close(c)
+	return c
+}
+
+// fakeMessage is an incoming mqtt.Message.
+type fakeMessage struct {
+	topic   string
+	payload string
+}
+
+func (m fakeMessage) Duplicate() bool   { return false }
+func (m fakeMessage) Qos() byte         { return 1 }
+func (m fakeMessage) Retained() bool    { return false }
+func (m fakeMessage) Topic() string     { return m.topic }
+func (m fakeMessage) MessageID() uint16 { return 0 }
+func (m fakeMessage) Payload() []byte   { return []byte(m.payload) }
+func (m fakeMessage) Ack()              {}
+
+// fakeClient stands in for a connected broker: it keeps what is published
+// retained and hands messages to the subscribed handlers. The methods the
+// bridge does not use panic through the nil embedded Client.
+type fakeClient struct {
+	mqtt.Client
+
+	mutex    sync.Mutex
+	retained map[string]string
+	handlers map[string]mqtt.MessageHandler
+}
+
+func newFakeClient() *fakeClient {
+	return &fakeClient{
+		retained: make(map[string]string),
+		handlers: make(map[string]mqtt.MessageHandler),
+	}
+}
+
+func (c *fakeClient) Publish(topic string, qos byte, retained bool, payload interface{}) mqtt.Token {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if retained {
+		c.retained[topic] = payload.(string)
+	}
+	return doneToken{}
+}
+
+func (c *fakeClient) Subscribe(topic string, qos byte, callback mqtt.MessageHandler) mqtt.Token {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.handlers[topic] = callback
+	return doneToken{}
+}
+
+// send delivers payload on topic as the broker would.
+func (c *fakeClient) send(t *testing.T, topic, payload string) {
+	t.Helper()
+	c.mutex.Lock()
+	h, ok := c.handlers[topic]
+	c.mutex.Unlock()
+	if !ok {
+		t.Fatalf("no subscription to %s", topic)
+	}
+	h(c, fakeMessage{topic, payload})
+}
+
+func (c *fakeClient) get(topic string) string {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.retained[topic]
+}
+
+// waitRetained waits for the retained value of topic to become want, as
+// state changes are published from the event bus.
+func (c *fakeClient) waitRetained(t *testing.T, topic, want string) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for c.get(topic) != want {
+		if time.Now().After(deadline) {
+			t.Fatalf("retained %s = %q, want %q", topic, c.get(topic), want)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func newTestBridge(t *testing.T) (*mqttBridge, *fakeClient, *fakeStore, func()) {
+	t.Helper()
+	st := &fakeStore{}
+	d, screens, cleanup := newTestDisplay(t, st)
+	c := newFakeClient()
+	b := &mqttBridge{
+		client:     c,
+		prefix:     "hexboard",
+		screenChan: screens,
+		d:          d,
+		timeout:    time.Hour,
+		store:      st,
+	}
+	b.onConnect(c)
+	b.watch(d.bus)
+	return b, c, st, cleanup
+}
+
+func TestMQTTConnectPublishesState(t *testing.T) {
+	_, c, _, cleanup := newTestBridge(t)
+	defer cleanup()
+
+	for topic, want := range map[string]string{
+		"hexboard/status":  "online",
+		"hexboard/mode":    modeRain,
+		"hexboard/message": "",
+		"hexboard/power":   "on",
+	} {
+		if got := c.get(topic); got != want {
+			t.Errorf("retained %s = %q, want %q", topic, got, want)
+		}
+	}
+}
+
+func TestMQTTMessageSet(t *testing.T) {
+	b, c, st, cleanup := newTestBridge(t)
+	defer cleanup()
+
+	c.send(t, "hexboard/message/set", "")
+	if saved := st.Saved(); len(saved) != 0 {
+		t.Errorf("empty message saved: %q", saved)
+	}
+
+	c.send(t, "hexboard/message/set", "hello mqtt")
+	if saved := st.Saved(); len(saved) != 1 || saved[0] != "hello mqtt" {
+		t.Errorf("saved %q, want the message", saved)
+	}
+	if mode, last := b.d.state(); mode != modeMessage || last != "hello mqtt" {
+		t.Errorf("state = %q, %q, want message, hello mqtt", mode, last)
+	}
+	c.waitRetained(t, "hexboard/mode", modeMessage)
+	c.waitRetained(t, "hexboard/message", "hello mqtt")
+}
+
+func TestMQTTModeSet(t *testing.T) {
+	b, c, _, cleanup := newTestBridge(t)
+	defer cleanup()
+
+	c.send(t, "hexboard/message/set", "back again")
+	c.waitRetained(t, "hexboard/mode", modeMessage)
+
+	c.send(t, "hexboard/mode/set", "rain\n")
+	if mode, _ := b.d.state(); mode != modeRain {
+		t.Errorf("mode after rain = %q", mode)
+	}
+	c.waitRetained(t, "hexboard/mode", modeRain)
+	c.waitRetained(t, "hexboard/message", "back again")
+
+	c.send(t, "hexboard/mode/set", "message")
+	if mode, last := b.d.state(); mode != modeMessage || last != "back again" {
+		t.Errorf("state after message = %q, %q", mode, last)
+	}
+	c.waitRetained(t, "hexboard/mode", modeMessage)
+
+	// no timers running: the mode stays
+	c.send(t, "hexboard/mode/set", "timer")
+	if mode, _ := b.d.state(); mode != modeMessage {
+		t.Errorf("mode after timer without timers = %q", mode)
+	}
+
+	if err := b.d.startTimer("tea", time.Hour, b.screenChan, b.timeout); err != nil {
+		t.Fatal(err)
+	}
+	c.send(t, "hexboard/mode/set", "rain")
+	c.send(t, "hexboard/mode/set", "timer")
+	if mode, _ := b.d.state(); mode != modeTimer {
+		t.Errorf("mode after timer = %q", mode)
+	}
+
+	c.send(t, "hexboard/mode/set", "disco")
+	if mode, _ := b.d.state(); mode != modeTimer {
+		t.Errorf("unknown mode changed the mode to %q", mode)
+	}
+}
+
+func TestMQTTCursorSet(t *testing.T) {
+	b, c, _, cleanup := newTestBridge(t)
+	defer cleanup()
+
+	c.send(t, "hexboard/cursor/set", "10 2")
+	if n := b.d.cursor.Clients(); n != 0 {
+		t.Errorf("shared cursor made %d client cursors", n)
+	}
+	c.send(t, "hexboard/cursor/set", "10 2 phone")
+	c.send(t, "hexboard/cursor/set", "11 2 phone")
+	c.send(t, "hexboard/cursor/set", "3 1 laptop")
+	if n := b.d.cursor.Clients(); n != 2 {
+		t.Errorf("%d client cursors, want 2", n)
+	}
+	c.send(t, "hexboard/cursor/set", "not a cursor")
+	if n := b.d.cursor.Clients(); n != 2 {
+		t.Errorf("bad payload: %d client cursors, want 2", n)
+	}
+}
+
+func TestMQTTMessageMarkup(t *testing.T) {
+	b, c, st, cleanup := newTestBridge(t)
+	defer cleanup()
+
+	c.send(t, "hexboard/message/set", "deploy {inverse}failed{/} again")
+	if saved := st.Saved(); len(saved) != 1 || saved[0] != "deploy {inverse}failed{/} again" {
+		t.Errorf("saved %q, want the message with its markup", saved)
+	}
+	if _, last := b.d.state(); last != "deploy failed again" {
+		t.Errorf("last = %q, want it without markup", last)
+	}
+	c.waitRetained(t, "hexboard/message", "deploy failed again")
+}
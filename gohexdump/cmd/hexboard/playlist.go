@@ -0,0 +1,249 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"post6.net/gohexdump/internal/font"
+	"post6.net/gohexdump/internal/playlist"
+	"post6.net/gohexdump/internal/screen"
+	"post6.net/gohexdump/internal/store"
+)
+
+// recentInterval is how long each stored message stays up on the recent
+// messages screen.
+const recentInterval = 8 * time.Second
+
+// idleBuilder turns playlist entries into screens.
+type idleBuilder struct {
+	clock screen.ClockOptions
+	store store.Store
+}
+
+// build returns the screen for e and, for screens holding a file or a
+// goroutine, how to release it.
+func (b *idleBuilder) build(e playlist.Entry) (screen.Screen, io.Closer, error) {
+	var s screen.Screen
+	var c io.Closer
+	switch e.Screen {
+	case playlist.Rain, playlist.Clock, playlist.RainClock:
+		var err error
+		if s, err = newIdleScreen(e.Screen, b.clock); err != nil {
+			return nil, nil, err
+		}
+	case playlist.Plasma:
+		t := screen.NewTextScreen(hexConf)
+		s = screen.NewFilterScreen(screen.NewPlasmaScreen(t, .8, 1), []screen.Filter{
+			screen.DefaultGamma(),
+		})
+	case playlist.Recent:
+		r := newRecentScreen(b.store)
+		s, c = r, r
+	case playlist.Video:
+		f, err := os.Open(e.File)
+		if err != nil {
+			return nil, nil, err
+		}
+		v, err := screen.OpenVideo(f, screen.NewTextScreen(hexConf), float64(e.FPS))
+		if err != nil {
+			f.Close()
+			return nil, nil, fmt.Errorf("%s: %v", e.File, err)
+		}
+		s, c = v, f
+	default:
+		return nil, nil, fmt.Errorf("unknown screen %q", e.Screen)
+	}
+	if e.Brightness > 0 && e.Brightness < 1 {
+		s = screen.NewFilterScreen(s, []screen.Filter{screen.NewBrightnessFilter(e.Brightness)})
+	}
+	return s, c, nil
+}
+
+// idlePlaylist is the idle screen: a playlist.Rotator, reloadable from the
+// web UI. The playlist text is kept as written, comments included.
+type idlePlaylist struct {
+	path    string
+	builder *idleBuilder
+	rotator *playlist.Rotator
+
+	mutex   sync.Mutex
+	text    string
+	closers []io.Closer
+}
+
+// defaultPlaylist is used without a playlist file: the -idle screen only.
+func defaultPlaylist(idle string) string {
+	return fmt.Sprintf("# Idle screens, shown in turn. See README.md for the fields.\n\n[[entry]]\nscreen = %q\n", idle)
+}
+
+// newIdlePlaylist loads the playlist at path. Without one, it plays the
+// playlist text def, which the web UI then starts from.
+func newIdlePlaylist(path, def string, b *idleBuilder) (*idlePlaylist, error) {
+	text := def
+	data, err := ioutil.ReadFile(path)
+	switch {
+	case err == nil:
+		text = string(data)
+	case !os.IsNotExist(err):
+		return nil, err
+	}
+	ip, err := playIdlePlaylist(path, text, b)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return ip, nil
+}
+
+// playIdlePlaylist plays the playlist text; the web UI saves edits to path.
+func playIdlePlaylist(path, text string, b *idleBuilder) (*idlePlaylist, error) {
+	p, err := playlist.Parse(text)
+	if err != nil {
+		return nil, err
+	}
+
+	fallback, _, err := b.build(playlist.Entry{Screen: playlist.Rain})
+	if err != nil {
+		return nil, err
+	}
+	ip := &idlePlaylist{path: path, builder: b}
+	screens, closers, err := ip.buildAll(p)
+	if err != nil {
+		return nil, err
+	}
+	ip.text, ip.closers = text, closers
+	ip.rotator = playlist.NewRotator(p, screens, fallback)
+	return ip, nil
+}
+
+func (ip *idlePlaylist) buildAll(p *playlist.Playlist) ([]screen.Screen, []io.Closer, error) {
+	var screens []screen.Screen
+	var closers []io.Closer
+	for i, e := range p.Entries {
+		s, c, err := ip.builder.build(e)
+		if err != nil {
+			closeAll(closers)
+			return nil, nil, fmt.Errorf("entry %d: %v", i+1, err)
+		}
+		screens = append(screens, s)
+		if c != nil {
+			closers = append(closers, c)
+		}
+	}
+	return screens, closers, nil
+}
+
+func closeAll(closers []io.Closer) {
+	for _, c := range closers {
+		c.Close()
+	}
+}
+
+// Text returns the playlist as last loaded or saved.
+func (ip *idlePlaylist) Text() string {
+	ip.mutex.Lock()
+	defer ip.mutex.Unlock()
+	return ip.text
+}
+
+// Update parses text, switches the rotation to it and saves it. Nothing
+// changes if the playlist is invalid or one of its screens fails to build.
+func (ip *idlePlaylist) Update(text string) error {
+	p, err := playlist.Parse(text)
+	if err != nil {
+		return err
+	}
+	screens, closers, err := ip.buildAll(p)
+	if err != nil {
+		return err
+	}
+	if err := playlist.Save(ip.path, text); err != nil {
+		closeAll(closers)
+		return err
+	}
+
+	ip.mutex.Lock()
+	defer ip.mutex.Unlock()
+	ip.rotator.Set(p, screens) // the old screens are no longer drawn
+	closeAll(ip.closers)
+	ip.text, ip.closers = text, closers
+	return nil
+}
+
+// recentScreen cycles through the stored messages, one every
+// recentInterval, dimly.
+type recentScreen struct {
+	screen.Screen
+	text  screen.TextScreen
+	store store.Store
+	quit  chan struct{}
+}
+
+func newRecentScreen(st store.Store) *recentScreen {
+	t := screen.NewTextScreen(hexConf)
+	t.SetFont(font.GetFont())
+	t.SetStyle(screen.NewBrightness(.4))
+	r := &recentScreen{
+		Screen: screen.NewFilterScreen(t, []screen.Filter{
+			screen.DefaultGamma(),
+			screen.NewAfterGlowFilter(.95),
+		}),
+		text:  t,
+		store: st,
+		quit:  make(chan struct{}),
+	}
+	go r.run()
+	return r
+}
+
+func (r *recentScreen) run() {
+	tick := time.NewTicker(recentInterval)
+	defer tick.Stop()
+	var msgs []string
+	i := 0
+	for {
+		if i >= len(msgs) {
+			var err error
+			if msgs, err = r.store.Recent(maxRecent); err != nil {
+				storeErrors.With("recent").Inc()
+				log.Printf("store: recent failed: %v", err)
+			}
+			i = 0
+		}
+		if i < len(msgs) {
+			r.show(msgs[i])
+			i++
+		}
+		select {
+		case <-tick.C:
+		case <-r.quit:
+			return
+		}
+	}
+}
+
+func (r *recentScreen) show(msg string) {
+	columns, rows := r.text.Size()
+	lines := strings.SplitN(strings.ToUpper(screen.StripMarkup(msg)), "\n", rows)
+	r.text.Hold()
+	r.text.Clear()
+	top := (rows - len(lines)) / 2
+	for n, line := range lines {
+		runes := []rune(line)
+		if len(runes) > columns {
+			runes = runes[:columns]
+		}
+		r.text.WriteAt(string(runes), (columns-len(runes))/2, top+n)
+	}
+	r.text.Update()
+}
+
+func (r *recentScreen) Close() error {
+	close(r.quit)
+	return nil
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"post6.net/gohexdump/internal/screen"
+)
+
+// tcpHandler maps the message port protocol (see package tcpserver) onto
+// the display.
+type tcpHandler struct {
+	screenChan chan<- screen.Screen
+	d          *display
+	timeout    time.Duration
+}
+
+func (h *tcpHandler) Message(text string) error {
+	messagesReceived.With(inputTCP).Inc()
+	h.d.showMessage(text, h.screenChan, h.timeout)
+	return nil
+}
+
+func (h *tcpHandler) Big(text string) error {
+	messagesReceived.With(inputTCP).Inc()
+	h.d.showBig(text, h.screenChan, h.timeout)
+	return nil
+}
+
+func (h *tcpHandler) Clear() error {
+	h.d.clear(h.screenChan)
+	return nil
+}
+
+func (h *tcpHandler) Cursor(col, row int) error {
+	messagesReceived.With(inputCursor).Inc()
+	h.d.moveCursor("", col, row, 0, h.screenChan)
+	return nil
+}
+
+func (h *tcpHandler) Style(name string) error {
+	style, err := screen.NamedStyle(name, h.d.text)
+	if err != nil {
+		return err
+	}
+	h.d.setStyle(style, h.screenChan)
+	return nil
+}
+
+func (h *tcpHandler) Mode(mode string) error {
+	switch mode {
+	case modeRain:
+		h.d.showRain(h.screenChan)
+	case modeMessage:
+		h.d.wake(h.screenChan, h.timeout)
+	case modeTimer:
+		return h.d.showTimers(h.screenChan)
+	default:
+		return fmt.Errorf("unknown mode %q (want %s, %s or %s)", mode, modeRain, modeMessage, modeTimer)
+	}
+	return nil
+}
+
+func (h *tcpHandler) Timer(name string, d time.Duration) error {
+	return h.d.startTimer(name, d, h.screenChan, h.timeout)
+}
+
+func (h *tcpHandler) StopTimer(name string) error {
+	return h.d.stopTimer(name)
+}
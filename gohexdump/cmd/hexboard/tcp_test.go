@@ -0,0 +1,54 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTCPMessages(t *testing.T) {
+	d, screens, cleanup := newTestDisplay(t, &fakeStore{})
+	defer cleanup()
+	h := &tcpHandler{screenChan: screens, d: d, timeout: time.Hour}
+
+	if err := h.Message("line one\nline two"); err != nil {
+		t.Fatal(err)
+	}
+	if mode, last := d.state(); mode != modeMessage || last != "line one\nline two" {
+		t.Errorf("state = %q, %q, want message, the message", mode, last)
+	}
+	if err := h.Big("{blink}HUGE"); err != nil {
+		t.Fatal(err)
+	}
+	if mode, last := d.state(); mode != modeMessage || last != "HUGE" {
+		t.Errorf("state = %q, %q, want message, HUGE", mode, last)
+	}
+
+	// CLEAR blanks the board but keeps the mode
+	if err := h.Clear(); err != nil {
+		t.Fatal(err)
+	}
+	if mode, _ := d.state(); mode != modeMessage {
+		t.Errorf("mode after clear = %q", mode)
+	}
+}
+
+func TestTCPTimerNeedsName(t *testing.T) {
+	d, screens, cleanup := newTestDisplay(t, &fakeStore{})
+	defer cleanup()
+	h := &tcpHandler{screenChan: screens, d: d, timeout: time.Hour}
+
+	for _, name := range []string{"", " ", "\t"} {
+		if err := h.Timer(name, time.Minute); err == nil {
+			t.Errorf("Timer(%q) started a timer", name)
+		}
+	}
+	if mode, _ := d.state(); mode != modeRain {
+		t.Errorf("mode = %q, want rain", mode)
+	}
+	if err := h.Timer("tea", time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	if mode, _ := d.state(); mode != modeTimer {
+		t.Errorf("mode = %q, want timer", mode)
+	}
+}
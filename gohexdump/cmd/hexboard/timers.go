@@ -0,0 +1,255 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"post6.net/gohexdump/internal/font"
+	"post6.net/gohexdump/internal/screen"
+)
+
+const (
+	maxTimers = 4               // one per row
+	timerHold = 5 * time.Second // how long "NAME NOW" stays up at zero
+)
+
+// Errors from timerBoard.start for requests that cannot be met.
+var (
+	errTimerName     = errors.New("timer needs a name")
+	errTooManyTimers = fmt.Errorf("too many timers (at most %d)", maxTimers)
+)
+
+// timer is a countdown, or a stopwatch if end is zero.
+type timer struct {
+	name  string
+	start time.Time
+	end   time.Time
+	done  time.Time // when a countdown reached zero
+}
+
+// TimerInfo describes a running timer for the web API.
+type TimerInfo struct {
+	Name      string  `json:"name"`
+	Stopwatch bool    `json:"stopwatch"`
+	Seconds   float64 `json:"seconds"` // remaining, or elapsed for a stopwatch
+}
+
+// timerBoard shows up to four named timers, one per row. While any timer
+// is active a goroutine redraws the rows; countdowns bounce in their last
+// minute, send a ripple burst along their row at zero and are removed
+// timerHold later.
+type timerBoard struct {
+	text   screen.TextScreen
+	ripple *screen.RippleFilter
+	screen screen.Screen
+	normal screen.Style
+	last   screen.Style
+	now    screen.Style
+
+	mutex   sync.Mutex
+	timers  []*timer
+	running bool
+	done    func(name string) // a countdown reached zero
+	empty   func()            // the last timer was removed
+}
+
+func newTimerBoard() *timerBoard {
+	s := screen.NewTextScreen(hexConf)
+	s.SetFont(font.GetFont())
+	ripple := screen.NewRippleFilter(.5, nil, identityTransform, s)
+	return &timerBoard{
+		text:   s,
+		ripple: ripple,
+		screen: screen.NewFilterScreen(s, []screen.Filter{
+			ripple,
+			screen.DefaultGamma(),
+			screen.NewAfterGlowFilter(.85),
+		}),
+		normal: screen.NewBrightness(.6),
+		last:   screen.NewBounce(.3, 1, time.Second),
+		now:    screen.NewBlink(.2, 1, 500*time.Millisecond),
+	}
+}
+
+// start starts or restarts the named timer; d == 0 starts a stopwatch.
+func (b *timerBoard) start(name string, d time.Duration) error {
+	if strings.TrimSpace(name) == "" {
+		return errTimerName
+	}
+	name = strings.ToUpper(name)
+	now := time.Now()
+	t := &timer{name: name, start: now}
+	if d > 0 {
+		t.end = now.Add(d)
+	}
+
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if i := b.find(name); i != -1 {
+		b.timers[i] = t
+	} else if len(b.timers) < maxTimers {
+		b.timers = append(b.timers, t)
+	} else {
+		return errTooManyTimers
+	}
+	if !b.running {
+		b.running = true
+		go b.run()
+	}
+	return nil
+}
+
+// onEmpty sets the function called when the last timer has been removed.
+func (b *timerBoard) onEmpty(f func()) {
+	b.mutex.Lock()
+	b.empty = f
+	b.mutex.Unlock()
+}
+
+// stop removes the named timer.
+func (b *timerBoard) stop(name string) error {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	i := b.find(strings.ToUpper(name))
+	if i == -1 {
+		return fmt.Errorf("no timer %q", name)
+	}
+	b.timers = append(b.timers[:i], b.timers[i+1:]...)
+	return nil
+}
+
+func (b *timerBoard) find(name string) int {
+	for i, t := range b.timers {
+		if t.name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// active reports whether any timer is shown.
+func (b *timerBoard) active() bool {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return len(b.timers) > 0
+}
+
+func (b *timerBoard) list() []TimerInfo {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	now := time.Now()
+	infos := make([]TimerInfo, 0, len(b.timers))
+	for _, t := range b.timers {
+		info := TimerInfo{Name: t.name, Stopwatch: t.end.IsZero()}
+		if info.Stopwatch {
+			info.Seconds = now.Sub(t.start).Seconds()
+		} else if left := t.end.Sub(now); left > 0 {
+			info.Seconds = left.Seconds()
+		}
+		infos = append(infos, info)
+	}
+	return infos
+}
+
+func (b *timerBoard) run() {
+	tick := time.NewTicker(100 * time.Millisecond)
+	defer tick.Stop()
+	for range tick.C {
+		b.mutex.Lock()
+		finished := b.update(time.Now())
+		done, empty := b.done, b.empty
+		if len(b.timers) == 0 {
+			b.running = false
+		}
+		running := b.running
+		b.mutex.Unlock()
+
+		// callbacks take the display lock, so call them without ours
+		for _, name := range finished {
+			if done != nil {
+				done(name)
+			}
+		}
+		if !running {
+			if empty != nil {
+				empty()
+			}
+			return
+		}
+	}
+}
+
+// update redraws the rows and retires countdowns held past zero. It
+// returns the names of countdowns that reached zero. Must be called with
+// b.mutex held.
+func (b *timerBoard) update(now time.Time) []string {
+	var finished []string
+	kept := b.timers[:0]
+	for _, t := range b.timers {
+		if !t.end.IsZero() && !now.Before(t.end) && t.done.IsZero() {
+			t.done = now
+			finished = append(finished, t.name)
+		}
+		if !t.done.IsZero() && now.Sub(t.done) > timerHold {
+			continue
+		}
+		kept = append(kept, t)
+	}
+	b.timers = kept
+
+	columns, _ := b.text.Size()
+	b.text.Hold()
+	b.text.Clear()
+	for row, t := range b.timers {
+		var line string
+		style := b.normal
+		switch {
+		case t.end.IsZero():
+			line = strings.TrimSpace(t.name + " " + clockString(now.Sub(t.start)))
+		case !t.done.IsZero():
+			line = strings.TrimSpace(t.name + " NOW")
+			style = b.now
+		default:
+			left := t.end.Sub(now)
+			// round up, so the last second shows 00:01 rather than 00:00
+			line = strings.TrimSpace(t.name + " IN " + clockString(left+time.Second-1))
+			if left <= time.Minute {
+				style = b.last
+			}
+		}
+		col := (columns - len([]rune(line))) / 2
+		if col < 0 {
+			col = 0
+		}
+		b.text.SetStyle(style)
+		b.text.WriteAt(line, col, row)
+	}
+	b.text.Update()
+
+	for _, name := range finished {
+		b.burst(b.find(name))
+	}
+	return finished
+}
+
+// burst ripples from several points along a row.
+func (b *timerBoard) burst(row int) {
+	columns, _ := b.text.Size()
+	for col := 0; col < columns; col += 8 {
+		if ix := b.text.DigitIndex(col, row); ix != -1 {
+			b.ripple.RippleAt(b.text.SegmentCoord(ix*16 + 3))
+		}
+	}
+}
+
+// clockString formats d as MM:SS, or H:MM:SS from an hour on.
+func clockString(d time.Duration) string {
+	s := int(d / time.Second)
+	if s >= 3600 {
+		return fmt.Sprintf("%d:%02d:%02d", s/3600, s/60%60, s%60)
+	}
+	return fmt.Sprintf("%02d:%02d", s/60, s%60)
+}
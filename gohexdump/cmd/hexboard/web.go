@@ -1,7 +1,7 @@
 package main
 
 import (
-	"database/sql"
+	"encoding/json"
 	"fmt"
 	"html/template"
 	"log"
@@ -9,6 +9,8 @@ import (
 	"strconv"
 	"time"
 
+	"post6.net/gohexdump/internal/metrics"
+	"post6.net/gohexdump/internal/playlist"
 	"post6.net/gohexdump/internal/screen"
 	"post6.net/gohexdump/internal/store"
 )
@@ -19,22 +21,33 @@ type webHandler struct {
 	screenChan chan<- screen.Screen
 	d          *display
 	timeout    time.Duration
-	db         *sql.DB
+	store      store.Store
 }
 
 func (h *webHandler) send(msg string) {
-	if err := store.Save(h.db, msg); err != nil {
+	messagesReceived.With(inputWeb).Inc()
+	h.save(msg)
+	h.d.showMessage(msg, h.screenChan, h.timeout)
+}
+
+// save adds msg to the message history.
+func (h *webHandler) save(msg string) {
+	if err := h.store.Save(msg); err != nil {
+		storeErrors.With("save").Inc()
 		log.Printf("store: save failed: %v", err)
 	}
-	h.d.showMessage(msg, h.screenChan, h.timeout)
 }
 
 func (h *webHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	switch r.URL.Path {
 
+	case "/metrics":
+		metrics.Handler().ServeHTTP(w, r)
+
 	case "/cursor":
-		// POST /cursor  body: x=<col>&y=<row>
+		// POST /cursor  body: x=<col>&y=<row>[&id=<client>]
 		// Lightweight endpoint for editor plugins to update cursor position.
+		// With an id, the client gets its own cursor for cursorTTL.
 		if r.Method != http.MethodPost {
 			w.WriteHeader(http.StatusMethodNotAllowed)
 			return
@@ -42,8 +55,46 @@ func (h *webHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		col, errCol := strconv.Atoi(r.FormValue("x"))
 		row, errRow := strconv.Atoi(r.FormValue("y"))
 		if errCol == nil && errRow == nil {
-			h.d.cursor.SetCursor(col, row)
+			messagesReceived.With(inputCursor).Inc()
+			id := r.FormValue("id")
+			ttl := time.Duration(0)
+			if id != "" {
+				ttl = cursorTTL
+			}
+			h.d.moveCursor(id, col, row, ttl, h.screenChan)
+		}
+		w.WriteHeader(http.StatusNoContent)
+
+	case "/timers":
+		h.timers(w, r)
+
+	case "/playlist":
+		h.playlist(w, r)
+
+	case "/brightness":
+		h.brightness(w, r)
+
+	case "/blank":
+		h.blank(w, r)
+
+	case "/style":
+		h.style(w, r)
+
+	case "/big":
+		// POST /big  body: text=<text>
+		// Shows the text in huge characters, like BIG on the TCP port.
+		if r.Method != http.MethodPost {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		text := r.FormValue("text")
+		if text == "" {
+			http.Error(w, "text is required", http.StatusBadRequest)
+			return
 		}
+		messagesReceived.With(inputWeb).Inc()
+		h.save(text)
+		h.d.showBig(text, h.screenChan, h.timeout)
 		w.WriteHeader(http.StatusNoContent)
 
 	default:
@@ -55,8 +106,9 @@ func (h *webHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
-		recent, err := store.Recent(h.db, maxRecent)
+		recent, err := h.store.Recent(maxRecent)
 		if err != nil {
+			storeErrors.With("recent").Inc()
 			log.Printf("store: recent failed: %v", err)
 			recent = nil
 		}
@@ -66,12 +118,178 @@ func (h *webHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-func startWebServer(addr string, screenChan chan<- screen.Screen, d *display, timeout time.Duration, db *sql.DB) {
+// timerRequest is the body of POST /timers. An empty duration starts a
+// stopwatch.
+type timerRequest struct {
+	Name     string `json:"name"`
+	Duration string `json:"duration"` // e.g. "5m", "90s"
+}
+
+// timers serves the timer API:
+//
+//	GET    /timers            list running timers as JSON
+//	POST   /timers            start or restart one: {"name":"DEMO","duration":"5m"}
+//	DELETE /timers?name=DEMO  remove one
+func (h *webHandler) timers(w http.ResponseWriter, r *http.Request) {
+	var err error
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		var req timerRequest
+		if err = json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "bad JSON: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		var d time.Duration
+		if req.Duration != "" {
+			if d, err = time.ParseDuration(req.Duration); err != nil || d <= 0 {
+				http.Error(w, fmt.Sprintf("bad duration %q", req.Duration), http.StatusBadRequest)
+				return
+			}
+		}
+		err = h.d.startTimer(req.Name, d, h.screenChan, h.timeout)
+	case http.MethodDelete:
+		err = h.d.stopTimer(r.FormValue("name"))
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	switch {
+	case err == errTimerName || err == errTooManyTimers:
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(h.d.timers.list())
+}
+
+// brightnessRequest is the body of POST /brightness. An empty duration
+// holds the level until DELETE.
+type brightnessRequest struct {
+	Level    float64 `json:"level"`
+	Duration string  `json:"duration"` // e.g. "1h"
+}
+
+// brightness serves the brightness API:
+//
+//	GET    /brightness  current, target and scheduled level as JSON
+//	POST   /brightness  override: {"level":0.3,"duration":"1h"}
+//	DELETE /brightness  end the override, back to the schedule
+func (h *webHandler) brightness(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		var req brightnessRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "bad JSON: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		var until time.Time
+		if req.Duration != "" {
+			d, err := time.ParseDuration(req.Duration)
+			if err != nil || d <= 0 {
+				http.Error(w, fmt.Sprintf("bad duration %q", req.Duration), http.StatusBadRequest)
+				return
+			}
+			until = time.Now().Add(d)
+		}
+		if err := h.d.brightness.Override(req.Level, until); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	case http.MethodDelete:
+		h.d.brightness.Clear()
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(h.d.brightness.State())
+}
+
+// style serves the style API, like the TCP STYLE command:
+//
+//	GET  /style             the style names as JSON
+//	POST /style name=<name>  style the current and following messages
+func (h *webHandler) style(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		style, err := screen.NamedStyle(r.FormValue("name"), h.d.text)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		h.d.setStyle(style, h.screenChan)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(screen.StyleNames())
+}
+
+// blank serves the blanking API:
+//
+//	GET    /blank  {"blanked":false,"idle":12.5,"after":900} (seconds)
+//	POST   /blank  fade out now, until the next input
+//	DELETE /blank  fade back in
+func (h *webHandler) blank(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		h.d.blank(h.screenChan)
+	case http.MethodDelete:
+		h.d.unblank(h.screenChan)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(h.d.blankState())
+}
+
+// playlistPage is the data for playlistTmpl.
+type playlistPage struct {
+	Text    string
+	Error   string
+	Saved   bool
+	Screens []string
+}
+
+// playlist shows the idle playlist as TOML for editing; POST applies and
+// saves it. An invalid playlist is shown again with the error.
+func (h *webHandler) playlist(w http.ResponseWriter, r *http.Request) {
+	page := playlistPage{Text: h.d.playlist.Text(), Screens: playlist.Screens}
+	switch r.Method {
+	case http.MethodGet:
+		page.Saved = r.FormValue("saved") != ""
+	case http.MethodPost:
+		text := r.FormValue("playlist")
+		if err := h.d.playlist.Update(text); err != nil {
+			page.Text, page.Error = text, err.Error()
+			w.WriteHeader(http.StatusBadRequest)
+			break
+		}
+		http.Redirect(w, r, "/playlist?saved=1", http.StatusSeeOther)
+		return
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	playlistTmpl.Execute(w, page)
+}
+
+func startWebServer(addr string, screenChan chan<- screen.Screen, d *display, timeout time.Duration, st store.Store) {
 	h := &webHandler{
 		screenChan: screenChan,
 		d:          d,
 		timeout:    timeout,
-		db:         db,
+		store:      st,
 	}
 	fmt.Printf("web interface on %s\n", addr)
 	http.ListenAndServe(addr, h)
@@ -213,6 +431,15 @@ var indexTmpl = template.Must(template.New("").Parse(`<!DOCTYPE html>
   }
   button.recent-btn::before { content: '> '; opacity: 0.4; }
   button.recent-btn:active { opacity: 1; color: #00ff41; }
+
+  a.nav {
+    font-size: 0.7rem;
+    letter-spacing: 0.2em;
+    color: #00ff41;
+    opacity: 0.35;
+    text-decoration: none;
+  }
+  a.nav:active { opacity: 1; }
 </style>
 </head>
 <body>
@@ -235,6 +462,8 @@ var indexTmpl = template.Must(template.New("").Parse(`<!DOCTYPE html>
     <button class="send" type="submit">SEND</button>
   </form>
 
+  <a class="nav" href="/playlist">IDLE PLAYLIST</a>
+
   {{if .}}
   <div class="recent">
     <div class="recent-label">RECENT</div>
@@ -249,3 +478,90 @@ var indexTmpl = template.Must(template.New("").Parse(`<!DOCTYPE html>
 </body>
 </html>
 `))
+
+var playlistTmpl = template.Must(template.New("").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="UTF-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>Hexboard playlist</title>
+<style>
+  *, *::before, *::after { box-sizing: border-box; margin: 0; padding: 0; }
+
+  body {
+    background: #0d0d0d;
+    color: #00ff41;
+    font-family: 'Courier New', Courier, monospace;
+    min-height: 100dvh;
+    display: flex;
+    flex-direction: column;
+    align-items: center;
+    padding: 2rem 1.25rem 3rem;
+    gap: 1.25rem;
+  }
+
+  h1 {
+    font-size: clamp(1.1rem, 5vw, 1.5rem);
+    letter-spacing: 0.3em;
+    font-weight: normal;
+    opacity: 0.6;
+  }
+
+  form, .help, .status { width: 100%; max-width: 640px; }
+
+  textarea {
+    width: 100%;
+    height: 24em;
+    padding: 0.85rem 1rem;
+    font-size: 0.9rem;
+    font-family: inherit;
+    background: #111;
+    color: #00ff41;
+    border: 1px solid #00ff41;
+    border-radius: 6px;
+    outline: none;
+    line-height: 1.5;
+  }
+
+  button {
+    width: 100%;
+    margin-top: 0.6rem;
+    padding: 0.9rem;
+    font-family: inherit;
+    font-weight: bold;
+    letter-spacing: 0.2em;
+    background: #00ff41;
+    color: #0d0d0d;
+    border: none;
+    border-radius: 6px;
+    cursor: pointer;
+  }
+
+  .status { font-size: 0.85rem; white-space: pre-wrap; }
+  .error { color: #ff4141; }
+  .help { font-size: 0.75rem; opacity: 0.5; line-height: 1.6; }
+  a { color: #00ff41; }
+</style>
+</head>
+<body>
+  <h1>[ IDLE PLAYLIST ]</h1>
+
+  {{if .Error}}<div class="status error">{{.Error}}</div>{{end}}
+  {{if .Saved}}<div class="status">Saved.</div>{{end}}
+
+  <form method="POST" action="/playlist">
+    <textarea name="playlist" spellcheck="false" autocapitalize="off"
+              autocorrect="off">{{.Text}}</textarea>
+    <button type="submit">SAVE</button>
+  </form>
+
+  <div class="help">
+    One <code>[[entry]]</code> per idle screen, shown in turn.
+    Fields: <code>screen</code> ({{range $i, $s := .Screens}}{{if $i}}, {{end}}{{$s}}{{end}}),
+    <code>dwell</code> (e.g. "2m"), <code>from</code> / <code>until</code> ("HH:MM"),
+    <code>brightness</code> (0&ndash;1), and <code>file</code> / <code>fps</code> for video.
+    <br><a href="/">&larr; back</a>
+  </div>
+</body>
+</html>
+`))
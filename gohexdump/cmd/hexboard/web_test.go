@@ -0,0 +1,122 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestWebHandler(t *testing.T, st *fakeStore) (*webHandler, func()) {
+	t.Helper()
+	d, screens, cleanup := newTestDisplay(t, st)
+	return &webHandler{screenChan: screens, d: d, timeout: time.Hour, store: st}, cleanup
+}
+
+func TestWebPostSavesAndShows(t *testing.T) {
+	st := &fakeStore{}
+	h, cleanup := newTestWebHandler(t, st)
+	defer cleanup()
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(url.Values{"message": {"hello board"}}.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	h.ServeHTTP(w, r)
+
+	if w.Code != http.StatusSeeOther {
+		t.Errorf("status = %d, want %d", w.Code, http.StatusSeeOther)
+	}
+	if got := st.Saved(); len(got) != 1 || got[0] != "hello board" {
+		t.Errorf("saved %q, want [\"hello board\"]", got)
+	}
+	if mode, last := h.d.state(); mode != modeMessage || last != "hello board" {
+		t.Errorf("state = %q, %q; want %q, \"hello board\"", mode, last, modeMessage)
+	}
+}
+
+func TestWebPostEmptyIsIgnored(t *testing.T) {
+	st := &fakeStore{}
+	h, cleanup := newTestWebHandler(t, st)
+	defer cleanup()
+
+	r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader("message="))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	h.ServeHTTP(httptest.NewRecorder(), r)
+
+	if got := st.Saved(); len(got) != 0 {
+		t.Errorf("saved %q, want nothing", got)
+	}
+}
+
+func TestWebIndexListsRecent(t *testing.T) {
+	st := &fakeStore{saved: []string{"first-saved", "<b>last-saved</b>"}}
+	h, cleanup := newTestWebHandler(t, st)
+	defer cleanup()
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	body := w.Body.String()
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d", w.Code)
+	}
+	newest, older := strings.Index(body, "&lt;b&gt;last-saved&lt;/b&gt;"), strings.Index(body, "first-saved")
+	if newest < 0 || older < 0 {
+		t.Fatalf("recent messages missing or not escaped in page")
+	}
+	if newest > older {
+		t.Errorf("newest message listed after older one")
+	}
+}
+
+func TestWebIndexSurvivesStoreError(t *testing.T) {
+	st := &fakeStore{err: errors.New("disk gone")}
+	h, cleanup := newTestWebHandler(t, st)
+	defer cleanup()
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	if w.Code != http.StatusOK {
+		t.Errorf("status = %d, want the page without history", w.Code)
+	}
+
+	// the message is still shown when saving fails
+	r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader("message=still+shown"))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	h.ServeHTTP(httptest.NewRecorder(), r)
+	if _, last := h.d.state(); last != "still shown" {
+		t.Errorf("last = %q, want \"still shown\"", last)
+	}
+}
+
+func TestWebTimerStatus(t *testing.T) {
+	h, cleanup := newTestWebHandler(t, &fakeStore{})
+	defer cleanup()
+
+	for _, test := range []struct {
+		method, target, body string
+		code                 int
+	}{
+		{http.MethodPost, "/timers", `{"name":"tea","duration":"5m"}`, http.StatusOK},
+		{http.MethodPost, "/timers", `{"name":"tea","duration":"3m"}`, http.StatusOK}, // restarts
+		{http.MethodPost, "/timers", `{"name":" ","duration":"5m"}`, http.StatusBadRequest},
+		{http.MethodPost, "/timers", `{"name":"egg","duration":"-1m"}`, http.StatusBadRequest},
+		{http.MethodPost, "/timers", `{"name":`, http.StatusBadRequest},
+		{http.MethodPost, "/timers", `{"name":"lap"}`, http.StatusOK},
+		{http.MethodPost, "/timers", `{"name":"egg","duration":"4m"}`, http.StatusOK},
+		{http.MethodPost, "/timers", `{"name":"pasta","duration":"9m"}`, http.StatusOK},
+		{http.MethodPost, "/timers", `{"name":"rice","duration":"9m"}`, http.StatusBadRequest}, // a fifth
+		{http.MethodDelete, "/timers?name=rice", "", http.StatusConflict},
+		{http.MethodDelete, "/timers?name=TEA", "", http.StatusOK},
+		{http.MethodPut, "/timers", "", http.StatusMethodNotAllowed},
+	} {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(test.method, test.target, strings.NewReader(test.body)))
+		if w.Code != test.code {
+			t.Errorf("%s %s %s: status %d, want %d", test.method, test.target, test.body, w.Code, test.code)
+		}
+	}
+}
@@ -0,0 +1,309 @@
+// hexdiff compares two files byte by byte and shows the dump on the
+// display: differing bytes pulse, identical bytes are dimmed, and the title
+// row shows the difference count and which one is selected. The view
+// scrolls to keep the selected byte on the board.
+//
+//	hexdiff old.bin new.bin
+//	hexdiff -watch capture.bin   compare a file against its contents at start
+//
+// Keys:
+//
+//	n / p       next / previous difference
+//	arrows      move by a byte / line, PgUp/PgDn by a screenful of lines
+//	Tab         show the other file's bytes
+//	r           reload both files
+//	Ctrl-C/D    quit
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"post6.net/gohexdump/internal/drivers"
+	"post6.net/gohexdump/internal/font"
+	"post6.net/gohexdump/internal/hexview"
+	"post6.net/gohexdump/internal/screen"
+	"post6.net/gohexdump/internal/util/keys"
+)
+
+var watch = flag.Bool("watch", false, "compare a single file against a snapshot taken at start, reloading as it changes")
+
+// run is a half-open range of differing offsets.
+type run struct {
+	start, end int64
+}
+
+// diff returns the differing ranges of a and b, bytes past the end of the
+// shorter one included, and the number of differing bytes.
+func diff(a, b []byte) ([]run, int64) {
+	var runs []run
+	var count int64
+	n := len(a)
+	if len(b) > n {
+		n = len(b)
+	}
+	for i := 0; i < n; i++ {
+		if i < len(a) && i < len(b) && a[i] == b[i] {
+			continue
+		}
+		count++
+		if l := len(runs); l > 0 && runs[l-1].end == int64(i) {
+			runs[l-1].end++
+		} else {
+			runs = append(runs, run{int64(i), int64(i) + 1})
+		}
+	}
+	return runs, count
+}
+
+type differ struct {
+	names    [2]string
+	load     [2]func() ([]byte, error)
+	data     [2][]byte
+	side     int // which file's bytes are shown
+	runs     []run
+	count    int64
+	pos      int64
+	top      int64 // offset of the first line shown
+	view     *hexview.View
+	cursor   screen.Cursor
+	same     screen.Style
+	changed  screen.Style
+	selected screen.Style
+}
+
+func (d *differ) reload() {
+	for i := range d.data {
+		if d.load[i] == nil {
+			continue
+		}
+		data, err := d.load[i]()
+		if err != nil {
+			log.Printf("%s: %v", d.names[i], err)
+			continue
+		}
+		d.data[i] = data
+	}
+	d.runs, d.count = diff(d.data[0], d.data[1])
+}
+
+func (d *differ) size() int64 {
+	n := len(d.data[0])
+	if len(d.data[1]) > n {
+		n = len(d.data[1])
+	}
+	return int64(n)
+}
+
+// current returns the index of the run containing pos, or -1.
+func (d *differ) current() int {
+	i := sort.Search(len(d.runs), func(i int) bool { return d.runs[i].end > d.pos })
+	if i < len(d.runs) && d.runs[i].start <= d.pos {
+		return i
+	}
+	return -1
+}
+
+func (d *differ) next() {
+	i := sort.Search(len(d.runs), func(i int) bool { return d.runs[i].start > d.pos })
+	if i < len(d.runs) {
+		d.pos = d.runs[i].start
+	}
+}
+
+func (d *differ) previous() {
+	i := sort.Search(len(d.runs), func(i int) bool { return d.runs[i].end > d.pos })
+	// i is the run containing pos or the first one after it
+	if i > 0 {
+		d.pos = d.runs[i-1].start
+	}
+}
+
+func (d *differ) differs(off int64) bool {
+	a, b := d.data[0], d.data[1]
+	if off >= int64(len(a)) || off >= int64(len(b)) {
+		return true
+	}
+	return a[off] != b[off]
+}
+
+func (d *differ) render() {
+	size := d.size()
+	if d.pos >= size {
+		d.pos = size - 1
+	}
+	if d.pos < 0 {
+		d.pos = 0
+	}
+
+	if d.top < 0 {
+		d.top = 0
+	}
+	d.top = d.view.Scroll(d.top, d.pos)
+	base := d.top
+	lines, _ := d.view.Visible()
+	shown := d.data[d.side]
+	var page []byte
+	if base < int64(len(shown)) {
+		end := base + int64(lines*hexview.LineSize)
+		if end > int64(len(shown)) {
+			end = int64(len(shown))
+		}
+		page = shown[base:end]
+	}
+
+	label := "A"
+	if d.side == 1 {
+		label = "B"
+	}
+	where := "-"
+	if i := d.current(); i != -1 {
+		where = fmt.Sprint(i + 1)
+	}
+	// the board shows only the start of the title row
+	title := fmt.Sprintf("%s/%d DIFF %d BYTES  %s %s  @%08X",
+		where, len(d.runs), d.count, label, d.names[d.side], d.pos)
+
+	sel := int(d.pos - base)
+	d.view.Render(title, base, page, func(i int) screen.Style {
+		switch {
+		case i == sel:
+			return d.selected
+		case d.differs(base + int64(i)):
+			return d.changed
+		default:
+			return d.same
+		}
+	})
+	d.cursor.SetCursor(d.view.Position(sel))
+}
+
+func (d *differ) key(k byte) {
+	lines, _ := d.view.Visible()
+	page := int64(lines * hexview.LineSize)
+	switch k {
+	case 'n', 'N':
+		d.next()
+	case 'p', 'P':
+		d.previous()
+	case keys.Left:
+		d.pos--
+	case keys.Right:
+		d.pos++
+	case keys.Up:
+		d.pos -= hexview.LineSize
+	case keys.Down:
+		d.pos += hexview.LineSize
+	case keys.PageUp:
+		d.pos -= page
+		d.top -= page
+	case keys.PageDown:
+		d.pos += page
+		d.top += page
+	case keys.Home:
+		d.pos = 0
+	case keys.End:
+		d.pos = d.size() - 1
+	case '\t':
+		d.side ^= 1
+	case 'r', 'R':
+		d.reload()
+	default:
+		return
+	}
+	d.render()
+}
+
+func loader(path string) func() ([]byte, error) {
+	return func() ([]byte, error) { return ioutil.ReadFile(path) }
+}
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: %s [flags] a b\n       %s -watch file\n", os.Args[0], os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	s := screen.NewHexScreen()
+	s.SetFont(font.GetFont())
+
+	d := &differ{
+		view:     hexview.New(s),
+		cursor:   screen.NewCursor(.8, s),
+		same:     screen.NewBrightness(.08),
+		changed:  screen.NewBounce(.4, .9, time.Second),
+		selected: screen.NewBrightness(1),
+	}
+
+	switch {
+	case *watch && flag.NArg() == 1:
+		path := flag.Arg(0)
+		snapshot, err := ioutil.ReadFile(path)
+		if err != nil {
+			log.Fatal(err)
+		}
+		d.names = [2]string{"SNAPSHOT", filepath.Base(path)}
+		d.data[0] = snapshot
+		d.load[1] = loader(path)
+		d.side = 1
+	case !*watch && flag.NArg() == 2:
+		d.names = [2]string{filepath.Base(flag.Arg(0)), filepath.Base(flag.Arg(1))}
+		d.load = [2]func() ([]byte, error){loader(flag.Arg(0)), loader(flag.Arg(1))}
+	default:
+		flag.Usage()
+		os.Exit(2)
+	}
+	d.reload()
+	if d.size() == 0 {
+		log.Fatal("nothing to compare: both inputs are empty")
+	}
+	d.pos = -1
+	d.next()
+	if d.pos < 0 {
+		d.pos = 0
+	}
+	d.render()
+
+	multi, screenChan := screen.NewMultiScreen()
+	screenChan <- screen.NewFilterScreen(s, []screen.Filter{
+		d.cursor,
+		screen.DefaultGamma(),
+		screen.NewAfterGlowFilter(.8),
+	})
+
+	q := make(chan bool)
+	ch := make(chan byte)
+	go keys.Raw(os.Stdin, ch)
+
+	go func() {
+		var poll <-chan time.Time
+		if *watch {
+			t := time.NewTicker(500 * time.Millisecond)
+			defer t.Stop()
+			poll = t.C
+		}
+	loop:
+		for {
+			select {
+			case k, ok := <-ch:
+				if !ok {
+					break loop // keys.Raw has restored the terminal
+				}
+				d.key(k)
+			case <-poll:
+				d.reload()
+				d.render()
+			}
+		}
+		screenChan <- screen.NewExitScreen(.5)
+	}()
+
+	screen.DisplayRoutine(drivers.GetDriver(s.SegmentCount()), multi, s, q)
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"io"
+	"log"
+	"net"
+	"sync"
+)
+
+// tee passes writes through to w and sends a copy of each to out.
+type tee struct {
+	w   io.Writer
+	dir int
+	out chan<- chunk
+}
+
+func (t *tee) Write(p []byte) (int, error) {
+	t.out <- chunk{dir: t.dir, data: append([]byte(nil), p...)}
+	return t.w.Write(p)
+}
+
+// proxyTCP listens on addr and forwards every connection to target,
+// capturing both directions.
+func proxyTCP(addr, target string, out chan<- chunk) error {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				log.Printf("accept: %v", err)
+				return
+			}
+			go proxy(conn, target, out)
+		}
+	}()
+	return nil
+}
+
+func proxy(client net.Conn, target string, out chan<- chunk) {
+	defer client.Close()
+	server, err := net.Dial("tcp", target)
+	if err != nil {
+		log.Printf("dial %s: %v", target, err)
+		return
+	}
+	defer server.Close()
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	pipe := func(dst, src net.Conn, dir int) {
+		defer wg.Done()
+		io.Copy(&tee{w: dst, dir: dir, out: out}, src)
+		// pass the half-close on, so request/response protocols finish
+		if c, ok := dst.(*net.TCPConn); ok {
+			c.CloseWrite()
+		}
+	}
+	go pipe(server, client, toTarget)
+	go pipe(client, server, fromTarget)
+	wg.Wait()
+}
+
+// captureUDP receives datagrams on addr.
+func captureUDP(addr string, out chan<- chunk) error {
+	conn, err := net.ListenPacket("udp", addr)
+	if err != nil {
+		return err
+	}
+	go func() {
+		buf := make([]byte, 65536)
+		for {
+			n, _, err := conn.ReadFrom(buf)
+			if err != nil {
+				log.Printf("udp: %v", err)
+				return
+			}
+			out <- chunk{dir: toTarget, data: append([]byte(nil), buf[:n]...)}
+		}
+	}()
+	return nil
+}
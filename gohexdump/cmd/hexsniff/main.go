@@ -0,0 +1,262 @@
+// hexsniff shows traffic as a live hexdump on the display. Bytes are
+// appended to the dump as they arrive, ripple in at their field, and older
+// lines scroll off the top.
+//
+//	hexsniff -listen :9000 -target db:5432   TCP proxy, both directions
+//	hexsniff -udp :5000                      UDP datagrams
+//	hexsniff -pty                            a pty; write to the printed path
+//
+// Through the proxy, bytes sent by the client are shown brighter than the
+// replies from the target.
+//
+// Keys:
+//
+//	space       pause / resume the display (capturing continues)
+//	c           clear
+//	Ctrl-C/D    quit
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"post6.net/gohexdump/internal/drivers"
+	"post6.net/gohexdump/internal/font"
+	"post6.net/gohexdump/internal/hexview"
+	"post6.net/gohexdump/internal/screen"
+	"post6.net/gohexdump/internal/util/keys"
+)
+
+var (
+	listen = flag.String("listen", "", "accept TCP connections on this address and proxy them to -target")
+	target = flag.String("target", "", "address the TCP proxy connects to")
+	udp    = flag.String("udp", "", "show datagrams received on this UDP address")
+	pty    = flag.Bool("pty", false, "create a pty and show everything written to it")
+)
+
+// Direction of captured bytes. Sources without a notion of direction use
+// toTarget.
+const (
+	toTarget = iota
+	fromTarget
+)
+
+// chunk is a run of captured bytes.
+type chunk struct {
+	dir  int
+	data []byte
+}
+
+func identityTransform(v screen.Vector2) screen.Vector2 { return v }
+
+type sniffer struct {
+	mu      sync.Mutex
+	source  string
+	window  int    // bytes shown: the whole lines that fit on the display
+	buf     []byte // the last bytes captured, starting on a line boundary
+	dirs    []int
+	base    int64 // offset of buf[0] in the capture
+	total   [2]int64
+	fresh   bool // something changed since the last render
+	arrived bool // bytes arrived since the last ripple
+	paused  bool
+	rate    float64
+	counted int64
+
+	view   *hexview.View
+	ripple *screen.RippleFilter
+	styles [2]screen.Style
+}
+
+func newSniffer(s screen.HexScreen, source string) *sniffer {
+	v := &sniffer{
+		source: source,
+		view:   hexview.New(s),
+		ripple: screen.NewRippleFilter(.4, nil, identityTransform, s),
+		styles: [2]screen.Style{screen.NewBrightness(.7), screen.NewBrightness(.3)},
+	}
+	lines := 0
+	for lines < hexview.PageSize/hexview.LineSize {
+		if _, ok := v.view.Origin(lines * hexview.LineSize); !ok {
+			break
+		}
+		lines++
+	}
+	if lines == 0 {
+		lines = 1
+	}
+	v.window = lines * hexview.LineSize
+	return v
+}
+
+func (v *sniffer) add(c chunk) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	v.total[c.dir] += int64(len(c.data))
+	v.buf = append(v.buf, c.data...)
+	for range c.data {
+		v.dirs = append(v.dirs, c.dir)
+	}
+	if over := len(v.buf) - v.window; over > 0 {
+		// drop whole lines so the dump stays aligned
+		drop := (over + hexview.LineSize - 1) / hexview.LineSize * hexview.LineSize
+		v.buf = append(v.buf[:0], v.buf[drop:]...)
+		v.dirs = append(v.dirs[:0], v.dirs[drop:]...)
+		v.base += int64(drop)
+	}
+	v.fresh, v.arrived = true, true
+}
+
+func (v *sniffer) clear() {
+	v.mu.Lock()
+	v.base += int64(len(v.buf))
+	v.base -= v.base % hexview.LineSize
+	v.buf, v.dirs = v.buf[:0], v.dirs[:0]
+	v.fresh = true
+	v.mu.Unlock()
+}
+
+func (v *sniffer) togglePause() {
+	v.mu.Lock()
+	v.paused = !v.paused
+	v.fresh = true
+	v.mu.Unlock()
+}
+
+// tick updates the byte rate once per second.
+func (v *sniffer) tick() {
+	v.mu.Lock()
+	n := v.total[0] + v.total[1]
+	v.rate = float64(n - v.counted)
+	v.counted = n
+	v.fresh = true
+	v.mu.Unlock()
+}
+
+// render redraws the dump if anything changed and ripples at the newest
+// byte.
+func (v *sniffer) render() {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	if !v.fresh {
+		return
+	}
+	v.fresh = false
+
+	state := ""
+	if v.paused {
+		state = " PAUSED"
+	}
+	title := fmt.Sprintf("%s  >%d <%d  %.0fB/S%s", v.source, v.total[toTarget], v.total[fromTarget], v.rate, state)
+	if v.paused {
+		v.view.Title(title)
+		return
+	}
+
+	dirs := v.dirs
+	v.view.Render(title, v.base, v.buf, func(i int) screen.Style {
+		if i < len(dirs) {
+			return v.styles[dirs[i]]
+		}
+		return nil
+	})
+	if n := len(v.buf); v.arrived && n > 0 {
+		v.arrived = false
+		if origin, ok := v.view.Origin(n - 1); ok {
+			v.ripple.RippleAt(origin)
+		}
+	}
+}
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: %s -listen addr -target addr | -udp addr | -pty\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	in := make(chan chunk, 64)
+	var source string
+	var err error
+	switch {
+	case *listen != "" && *target != "" && *udp == "" && !*pty:
+		source = "TCP " + *target
+		err = proxyTCP(*listen, *target, in)
+	case *udp != "" && *listen == "" && !*pty:
+		source = "UDP " + *udp
+		err = captureUDP(*udp, in)
+	case *pty && *listen == "" && *udp == "":
+		var name string
+		name, err = capturePty(in)
+		source = name
+		if err == nil {
+			log.Printf("capturing %s", name)
+		}
+	default:
+		flag.Usage()
+		os.Exit(2)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	s := screen.NewHexScreen()
+	s.SetFont(font.GetFont())
+
+	v := newSniffer(s, source)
+	v.render()
+
+	multi, screenChan := screen.NewMultiScreen()
+	screenChan <- screen.NewFilterScreen(s, []screen.Filter{
+		v.ripple,
+		screen.DefaultGamma(),
+		screen.NewAfterGlowFilter(.85),
+	})
+
+	go func() {
+		for c := range in {
+			v.add(c)
+		}
+	}()
+
+	q := make(chan bool)
+	ch := make(chan byte)
+	go keys.Raw(os.Stdin, ch)
+
+	go func() {
+		// redraw at most 20 times a second, so a burst of traffic is one
+		// update and one ripple rather than one per read
+		frame := time.NewTicker(50 * time.Millisecond)
+		defer frame.Stop()
+		second := time.NewTicker(time.Second)
+		defer second.Stop()
+	loop:
+		for {
+			select {
+			case k, ok := <-ch:
+				if !ok {
+					break loop // keys.Raw has restored the terminal
+				}
+				switch k {
+				case ' ':
+					v.togglePause()
+				case 'c', 'C':
+					v.clear()
+				}
+			case <-frame.C:
+				v.render()
+			case <-second.C:
+				v.tick()
+			}
+		}
+		screenChan <- screen.NewExitScreen(.5)
+	}()
+
+	screen.DisplayRoutine(drivers.GetDriver(s.SegmentCount()), multi, s, q)
+}
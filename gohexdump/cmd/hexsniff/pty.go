@@ -0,0 +1,71 @@
+// +build linux,cgo
+
+package main
+
+/*
+#define _GNU_SOURCE
+#include <fcntl.h>
+#include <stdlib.h>
+#include <unistd.h>
+
+int open_pty(char *name, int len)
+{
+	int fd = posix_openpt(O_RDWR | O_NOCTTY);
+	if (fd < 0)
+		return -1;
+
+	if (grantpt(fd) < 0 || unlockpt(fd) < 0 || ptsname_r(fd, name, len) != 0) {
+		close(fd);
+		return -1;
+	}
+
+	return fd;
+}
+*/
+import "C"
+
+import (
+	"log"
+	"os"
+	"syscall"
+	"unsafe"
+
+	"post6.net/gohexdump/internal/drivers"
+)
+
+// capturePty creates a pty and sends everything written to its slave side.
+// It returns the slave's path.
+func capturePty(out chan<- chunk) (string, error) {
+	var name [64]C.char
+	fd, err := C.open_pty(&name[0], C.int(len(name)))
+	if fd < 0 {
+		return "", err
+	}
+	path := C.GoString((*C.char)(unsafe.Pointer(&name[0])))
+	master := os.NewFile(uintptr(fd), "ptmx")
+
+	// Keep the slave open ourselves: the master then keeps working after
+	// a writer closes it, and it is switched to binary so bytes pass
+	// through untranslated.
+	slave, err := os.OpenFile(path, os.O_RDWR|syscall.O_NOCTTY, 0)
+	if err != nil {
+		master.Close()
+		return "", err
+	}
+	drivers.SetBinary(slave)
+
+	go func() {
+		defer slave.Close()
+		defer master.Close()
+		buf := make([]byte, 4096)
+		for {
+			n, err := master.Read(buf)
+			if err != nil {
+				log.Printf("pty: %v", err)
+				return
+			}
+			out <- chunk{dir: toTarget, data: append([]byte(nil), buf[:n]...)}
+		}
+	}()
+	return path, nil
+}
@@ -0,0 +1,10 @@
+// +build !linux !cgo
+
+package main
+
+import "errors"
+
+// capturePty needs glibc's pty calls, see pty.go.
+func capturePty(out chan<- chunk) (string, error) {
+	return "", errors.New("-pty is only supported on linux, built with cgo")
+}
@@ -0,0 +1,247 @@
+// hextail scrolls lines from stdin or a file up the display, like tail -f.
+//
+//	make 2>&1 | hextail
+//	hextail -f /var/log/deploy.log -highlight 'ERROR|FAIL=blink' -highlight 'OK=bright'
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+	"unicode"
+
+	"post6.net/gohexdump/internal/drivers"
+	"post6.net/gohexdump/internal/font"
+	"post6.net/gohexdump/internal/screen"
+)
+
+var conf = screen.Configuration{
+	{Column: 0, Row: 0, Type: screen.HorizontalPanel},
+	{Column: 0, Row: 1, Type: screen.HorizontalPanel},
+	{Column: 0, Row: 2, Type: screen.HorizontalPanel},
+	{Column: 0, Row: 3, Type: screen.HorizontalPanel},
+}
+
+// rule styles the parts of a line matching re.
+type rule struct {
+	re    *regexp.Regexp
+	style screen.Style
+}
+
+// rules collects repeated -highlight 'regexp=style' flags.
+type rules []rule
+
+func (r *rules) String() string {
+	return fmt.Sprintf("%d rules", len(*r))
+}
+
+func (r *rules) Set(v string) error {
+	i := strings.LastIndex(v, "=")
+	if i < 0 {
+		return fmt.Errorf("want regexp=style, got %q", v)
+	}
+	re, err := regexp.Compile(v[:i])
+	if err != nil {
+		return err
+	}
+	style, err := screen.NamedStyle(v[i+1:], screen.NewTextScreen(conf)) // lays out gradients
+	if err != nil {
+		return fmt.Errorf("%v (known: %s)", err, strings.Join(screen.StyleNames(), ", "))
+	}
+	*r = append(*r, rule{re: re, style: style})
+	return nil
+}
+
+var (
+	follow     = flag.Bool("f", false, "keep reading the file as it grows (like tail -f)")
+	wrap       = flag.Bool("wrap", true, "wrap long lines instead of truncating them")
+	brightness = flag.Float64("brightness", .6, "brightness of unhighlighted text")
+	highlight  rules
+)
+
+func init() {
+	flag.Var(&highlight, "highlight", "regexp=style: show matches in a style (repeatable; first matching rule wins per character)")
+}
+
+func identityTransform(v screen.Vector2) screen.Vector2 { return v }
+
+// tail writes each line to the bottom row, scrolling the screen up.
+type tail struct {
+	s      screen.TextScreen
+	ripple *screen.RippleFilter
+	normal screen.Style
+}
+
+// styles returns the style for each rune of line.
+func (t *tail) styles(line []rune) []screen.Style {
+	out := make([]screen.Style, len(line))
+	for i := range out {
+		out[i] = t.normal
+	}
+	str := string(line)
+	for i := len(highlight) - 1; i >= 0; i-- {
+		r := highlight[i]
+		for _, m := range r.re.FindAllStringIndex(str, -1) {
+			// byte offsets → rune offsets
+			start := len([]rune(str[:m[0]]))
+			end := start + len([]rune(str[m[0]:m[1]]))
+			for j := start; j < end; j++ {
+				out[j] = r.style
+			}
+		}
+	}
+	return out
+}
+
+func (t *tail) line(text string) {
+	runes := []rune(strings.Replace(text, "\t", "    ", -1))
+	// match the highlights against the text as written; only the font
+	// needs upper case
+	styles := t.styles(runes)
+	for i, r := range runes {
+		runes[i] = unicode.ToUpper(r)
+	}
+	columns, rows := t.s.Size()
+
+	for first := true; first || len(runes) > 0; first = false {
+		n := len(runes)
+		if n > columns {
+			n = columns
+		}
+
+		t.s.Hold()
+		t.s.Scroll(0, 1)
+		for col := 0; col < n; col++ {
+			t.s.SetStyle(styles[col])
+			t.s.WriteAt(string(runes[col]), col, rows-1)
+		}
+		t.s.Update()
+
+		if ix := t.s.DigitIndex(0, rows-1); ix != -1 {
+			t.ripple.RippleAt(t.s.SegmentCoord(ix*16 + 3))
+		}
+
+		runes, styles = runes[n:], styles[n:]
+		if !*wrap {
+			break
+		}
+	}
+}
+
+// lines sends every line read from r; with follow set it keeps polling
+// after EOF and reopens path when the file is truncated or replaced.
+func lines(path string, out chan<- string) {
+	defer close(out)
+
+	if path == "" {
+		scanner := bufio.NewScanner(os.Stdin)
+		for scanner.Scan() {
+			out <- scanner.Text()
+		}
+		return
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if *follow {
+		// start near the end, like tail: skip to the last few KB
+		if fi, err := f.Stat(); err == nil && fi.Size() > 4096 {
+			f.Seek(-4096, io.SeekEnd)
+		}
+	}
+	r := bufio.NewReader(f)
+	var partial string
+	var pos int64
+	if *follow {
+		pos, _ = f.Seek(0, io.SeekCurrent)
+		if pos != 0 {
+			// drop the partial first line
+			skipped, _ := r.ReadString('\n')
+			pos += int64(len(skipped))
+		}
+	}
+
+	for {
+		s, err := r.ReadString('\n')
+		pos += int64(len(s))
+		partial += s
+		if err == nil {
+			out <- strings.TrimRight(partial, "\r\n")
+			partial = ""
+			continue
+		}
+		if err != io.EOF {
+			log.Fatal(err)
+		}
+		if !*follow {
+			if partial != "" {
+				out <- partial
+			}
+			return
+		}
+
+		time.Sleep(250 * time.Millisecond)
+		if fi, err := os.Stat(path); err == nil {
+			cur, _ := f.Stat()
+			if !os.SameFile(fi, cur) || fi.Size() < pos {
+				// rotated or truncated: start over on the new file
+				if nf, err := os.Open(path); err == nil {
+					f.Close()
+					f, r, pos, partial = nf, bufio.NewReader(nf), 0, ""
+				}
+			}
+		}
+	}
+}
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: %s [flags] [file]\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	path := flag.Arg(0)
+	if *follow && path == "" {
+		log.Fatal("-f needs a file")
+	}
+
+	s := screen.NewTextScreen(conf)
+	s.SetFont(font.GetFont())
+
+	t := &tail{
+		s:      s,
+		ripple: screen.NewRippleFilter(.3, nil, identityTransform, s),
+		normal: screen.NewBrightness(*brightness),
+	}
+
+	multi, screenChan := screen.NewMultiScreen()
+	screenChan <- screen.NewFilterScreen(s, []screen.Filter{
+		t.ripple,
+		screen.DefaultGamma(),
+		screen.NewAfterGlowFilter(.85),
+	})
+
+	in := make(chan string)
+	go lines(path, in)
+
+	q := make(chan bool)
+	go func() {
+		for l := range in {
+			t.line(l)
+		}
+		// input ended: leave the last lines up briefly, then fade out
+		time.Sleep(5 * time.Second)
+		screenChan <- screen.NewExitScreen(.5)
+	}()
+
+	screen.DisplayRoutine(drivers.GetDriver(s.SegmentCount()), multi, s, q)
+}
@@ -0,0 +1,193 @@
+// hexview shows a file as a hexdump on the display, navigated from the
+// keyboard. The view scrolls to keep the selected byte on the board.
+//
+//	arrows      move the selected byte (left/right by one, up/down by a line)
+//	PgUp/PgDn   previous/next screenful of lines
+//	Home/End    start/end of file
+//	f           toggle follow mode: track the end of a growing file
+//	Ctrl-C/D    quit
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"post6.net/gohexdump/internal/drivers"
+	"post6.net/gohexdump/internal/font"
+	"post6.net/gohexdump/internal/hexview"
+	"post6.net/gohexdump/internal/screen"
+	"post6.net/gohexdump/internal/util/keys"
+)
+
+var follow = flag.Bool("f", false, "start in follow mode (track the end of a growing file)")
+
+type viewer struct {
+	file     *os.File
+	name     string
+	size     int64
+	pos      int64 // selected byte
+	top      int64 // offset of the first line shown
+	follow   bool
+	view     *hexview.View
+	cursor   screen.Cursor
+	selected screen.Style
+}
+
+// stat refreshes the file size; it reports whether it changed.
+func (v *viewer) stat() bool {
+	fi, err := v.file.Stat()
+	if err != nil {
+		log.Printf("stat: %v", err)
+		return false
+	}
+	changed := fi.Size() != v.size
+	v.size = fi.Size()
+	return changed
+}
+
+func (v *viewer) clamp() {
+	if v.pos >= v.size {
+		v.pos = v.size - 1
+	}
+	if v.pos < 0 {
+		v.pos = 0
+	}
+}
+
+func (v *viewer) render() {
+	if v.follow {
+		v.pos = v.size - 1
+	}
+	v.clamp()
+
+	if v.top < 0 {
+		v.top = 0
+	}
+	v.top = v.view.Scroll(v.top, v.pos)
+	lines, _ := v.view.Visible()
+	data := make([]byte, lines*hexview.LineSize)
+	n, err := v.file.ReadAt(data, v.top)
+	if err != nil && err != io.EOF {
+		log.Printf("read: %v", err)
+	}
+	data = data[:n]
+
+	mode := ""
+	if v.follow {
+		mode = " FOLLOW"
+	}
+	title := fmt.Sprintf("%s  %08X/%08X%s", v.name, v.pos, v.size, mode)
+	sel := int(v.pos - v.top)
+	v.view.Render(title, v.top, data, func(i int) screen.Style {
+		if i == sel {
+			return v.selected
+		}
+		return nil
+	})
+	v.cursor.SetCursor(v.view.Position(sel))
+}
+
+func (v *viewer) key(k byte) {
+	moved := true
+	lines, _ := v.view.Visible()
+	page := int64(lines * hexview.LineSize)
+	switch k {
+	case keys.Left:
+		v.pos--
+	case keys.Right:
+		v.pos++
+	case keys.Up:
+		v.pos -= hexview.LineSize
+	case keys.Down:
+		v.pos += hexview.LineSize
+	case keys.PageUp:
+		v.pos -= page
+		v.top -= page
+	case keys.PageDown:
+		v.pos += page
+		v.top += page
+	case keys.Home:
+		v.pos = 0
+	case keys.End:
+		v.pos = v.size - 1
+	case 'f', 'F':
+		v.follow = !v.follow
+		moved = false
+	default:
+		return
+	}
+	if moved {
+		v.follow = false
+	}
+	v.render()
+}
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: %s [flags] file\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() != 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	f, err := os.Open(flag.Arg(0))
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer f.Close()
+
+	s := screen.NewHexScreen()
+	s.SetFont(font.GetFont())
+
+	v := &viewer{
+		file:     f,
+		name:     filepath.Base(f.Name()),
+		follow:   *follow,
+		view:     hexview.New(s),
+		cursor:   screen.NewCursor(.8, s),
+		selected: screen.NewBounce(.6, 1, time.Second),
+	}
+	v.stat()
+	v.render()
+
+	multi, screenChan := screen.NewMultiScreen()
+	screenChan <- screen.NewFilterScreen(s, []screen.Filter{
+		v.cursor,
+		screen.DefaultGamma(),
+		screen.NewAfterGlowFilter(.8),
+	})
+
+	q := make(chan bool)
+	ch := make(chan byte)
+	go keys.Raw(os.Stdin, ch)
+
+	go func() {
+		poll := time.NewTicker(500 * time.Millisecond)
+		defer poll.Stop()
+	loop:
+		for {
+			select {
+			case k, ok := <-ch:
+				if !ok {
+					break loop // keys.Raw has restored the terminal
+				}
+				v.key(k)
+			case <-poll.C:
+				if v.stat() {
+					v.render()
+				}
+			}
+		}
+		screenChan <- screen.NewExitScreen(.5)
+	}()
+
+	screen.DisplayRoutine(drivers.GetDriver(s.SegmentCount()), multi, s, q)
+}
@@ -1,66 +1,122 @@
-
 package main
 
 import (
-	"post6.net/gohexdump/internal/drivers"
-	"post6.net/gohexdump/internal/screen"
-	"os"
+	"flag"
+	"fmt"
 	"io"
+	"log"
+	"os"
 	"time"
-	"flag"
-	"math"
+
+	"post6.net/gohexdump/internal/drivers"
+	"post6.net/gohexdump/internal/screen"
+	"post6.net/gohexdump/internal/segvideo"
 )
 
-var fps int
-var gamma float64
+var (
+	fps   float64
+	gamma float64
+	raw   bool
+	loop  bool
+	seek  time.Duration
+)
 
 func init() {
+	flag.Float64Var(&fps, "fps", 0, "frame rate (default: the video's, 30 for -raw)")
+	flag.Float64Var(&gamma, "gamma", 2.5, "gamma of -raw video")
+	flag.BoolVar(&raw, "raw", false, "play headerless raw video, one byte per segment")
+	flag.BoolVar(&loop, "loop", false, "play again from the start at the end (needs a file)")
+	flag.DurationVar(&seek, "seek", 0, "start this far into the video (needs a file)")
+
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: %s [flags] [file]\n\n", os.Args[0])
+		fmt.Fprintf(flag.CommandLine.Output(), "Plays segment video from encvid, from file or stdin.\n\n")
+		flag.PrintDefaults()
+	}
+}
 
-	flag.IntVar(&fps, "fps", 30, "fps")
-	flag.Float64Var(&gamma, "gamma", 2.5, "gamma")
+func open(in io.Reader, info screen.ScreenInfo) (*segvideo.Reader, error) {
+	if raw {
+		rate := fps
+		if rate <= 0 {
+			rate = 30
+		}
+		return segvideo.NewRawReader(in, info.SegmentCount(), rate, gamma)
+	}
+	r, err := segvideo.NewReader(in)
+	if err == segvideo.ErrNoHeader {
+		return nil, fmt.Errorf("not segment video; use -raw for headerless video")
+	}
+	return r, err
 }
 
 func main() {
-
 	flag.Parse()
 
-	size := screen.NewHexScreen().SegmentCount()
+	var in io.Reader = os.Stdin
+	if flag.NArg() > 1 {
+		flag.Usage()
+		os.Exit(2)
+	} else if flag.NArg() == 1 {
+		f, err := os.Open(flag.Arg(0))
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer f.Close()
+		in = f
+	}
 
-	var gmap [256]float64
-	var buf     = make([]byte, size)
-	var buf_f64 = make([]float64, size)
+	info := screen.NewHexScreen()
+	r, err := open(in, info)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := r.Check(info.SegmentCount(), screen.LayoutHash(info)); err != nil {
+		log.Fatal(err)
+	}
+	if r.Frames() < 0 && (loop || seek > 0) {
+		log.Fatal("-loop and -seek need a file, not a pipe")
+	}
+	rate := fps
+	if rate <= 0 {
+		rate = r.Header().FPS
+	}
 
-	for i := range gmap {
-		v := math.Pow(float64(i)/255, gamma)
-		if v > 1 {
-			v = 1
-		} else if v < 0 {
-			v = 0
+	if seek > 0 {
+		frame := int(seek.Seconds() * r.Header().FPS)
+		if n := r.Frames(); frame > n {
+			log.Fatalf("-seek %v is past the end of the video (%d frames)", seek, n)
+		}
+		if err := r.Seek(frame); err != nil {
+			log.Fatal(err)
 		}
-		gmap[i] = v
 	}
 
-	out := drivers.GetDriver(len(buf))
-
-	tick := time.NewTicker(time.Second / time.Duration(fps))
-	for {
-		if _, err := io.ReadFull(os.Stdin, buf[:]); err != nil {
-			print("break")
+	frame := make([]float64, info.SegmentCount())
+	out := drivers.GetDriver(len(frame))
+
+	tick := time.NewTicker(time.Duration(float64(time.Second) / rate))
+	for shown := 0; ; shown++ {
+		err := r.ReadFrame(frame)
+		if err == io.EOF && loop && shown > 0 {
+			err = r.Seek(0)
+			if err == nil {
+				err = r.ReadFrame(frame)
+			}
+		}
+		if err == io.EOF {
 			break
 		}
-
-		for i := range(buf) {
-			buf_f64[i] = gmap[buf[i]]
+		if err != nil {
+			log.Fatal(err)
 		}
 
-		print("writing buffer")
-		out.Write(buf_f64[:])
+		out.Write(frame)
 
 		<-tick.C
 	}
-	for i := range(buf) {
-		buf_f64[i] = 0
+	for i := range frame {
+		frame[i] = 0
 	}
-	out.Write(buf_f64[:])
+	out.Write(frame)
 }
-
@@ -7,11 +7,12 @@ import (
 	"post6.net/gohexdump/internal/tcpserver"
 	"post6.net/gohexdump/internal/util/keys"
 
+	"log"
 	"os"
 	//	"fmt"
 	//	"bufio"
 	"flag"
-	//	"time"P
+	"time"
 
 	"runtime/pprof"
 	"strings"
@@ -74,6 +75,25 @@ loop:
 	}
 }
 
+// typist feeds messages from the TCP port into the terminal as if typed.
+type typist chan<- byte
+
+func (t typist) Message(text string) error {
+	for _, c := range []byte(text + "\n") {
+		t <- c
+		time.Sleep(30 * time.Millisecond)
+	}
+	return nil
+}
+
+func (t typist) Big(text string) error                    { return tcpserver.ErrUnsupported }
+func (t typist) Clear() error                             { return tcpserver.ErrUnsupported }
+func (t typist) Cursor(column, row int) error             { return tcpserver.ErrUnsupported }
+func (t typist) Style(name string) error                  { return tcpserver.ErrUnsupported }
+func (t typist) Mode(mode string) error                   { return tcpserver.ErrUnsupported }
+func (t typist) Timer(name string, d time.Duration) error { return tcpserver.ErrUnsupported }
+func (t typist) StopTimer(name string) error              { return tcpserver.ErrUnsupported }
+
 func main() {
 
 	flag.Parse()
@@ -127,7 +147,11 @@ func main() {
 		screenChan <- screen.NewExitScreen(.5)
 	}()
 
-	go tcpserver.Start(ch)
+	go func() {
+		if err := tcpserver.ListenAndServe("0.0.0.0:8080", typist(ch)); err != nil {
+			log.Print(err)
+		}
+	}()
 
 	// close(q)
 
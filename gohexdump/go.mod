@@ -3,8 +3,9 @@ module post6.net/gohexdump
 go 1.13
 
 require (
-	github.com/BurntSushi/toml v1.3.2 // indirect
-	github.com/jacobsa/go-serial v0.0.0-20180131005756-15cf729a72d4 // indirect
-	github.com/mattn/go-sqlite3 v1.14.34 // indirect
+	github.com/BurntSushi/toml v1.3.2
+	github.com/eclipse/paho.mqtt.golang v1.3.5
+	github.com/jacobsa/go-serial v0.0.0-20180131005756-15cf729a72d4
+	github.com/mattn/go-sqlite3 v1.14.34
 	golang.org/x/term v0.5.0
 )
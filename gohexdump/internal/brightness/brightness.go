@@ -0,0 +1,237 @@
+// Package brightness dims the board on a schedule. It reads a TOML config
+// at /var/lib/hexboard/brightness.toml with a day and a night level, and
+// switches between them either at fixed times of day or at sunrise and
+// sunset computed from configured coordinates (no network needed). The
+// levels are applied through a screen.BrightnessControl, fading smoothly,
+// and can be overridden at runtime through the API.
+package brightness
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/BurntSushi/toml"
+
+	"post6.net/gohexdump/internal/screen"
+)
+
+const configPath = "/var/lib/hexboard/brightness.toml"
+
+// overrideFade is how fast an override (or its end) fades in.
+const overrideFade = 2 * time.Second
+
+// Config is the contents of brightness.toml.
+type Config struct {
+	Day   float64 `toml:"day"`   // level by day, 0 to 1 (default 1)
+	Night float64 `toml:"night"` // level by night, 0 to 1 (default .2)
+
+	// Fade is how long a scheduled change takes, e.g. "15m" (default 10m).
+	Fade string `toml:"fade"`
+
+	// Either fixed times, "HH:MM" local time...
+	DayStart   string `toml:"day_start"`
+	NightStart string `toml:"night_start"`
+
+	// ...or coordinates for sunrise and sunset.
+	Latitude  *float64 `toml:"latitude"`
+	Longitude *float64 `toml:"longitude"`
+
+	fade                 time.Duration
+	dayStart, nightStart int // minutes since midnight
+}
+
+// LoadConfig reads /var/lib/hexboard/brightness.toml.
+// Returns (nil, nil) if the file is absent — the board stays at full
+// brightness unless overridden.
+func LoadConfig() (*Config, error) {
+	var cfg Config
+	md, err := toml.DecodeFile(configPath, &cfg)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	if !md.IsDefined("day") {
+		cfg.Day = 1
+	}
+	if !md.IsDefined("night") {
+		cfg.Night = .2
+	}
+	if err := cfg.validate(); err != nil {
+		return nil, fmt.Errorf("brightness.toml: %v", err)
+	}
+	return &cfg, nil
+}
+
+func (c *Config) validate() error {
+	if c.Day < 0 || c.Day > 1 || c.Night < 0 || c.Night > 1 {
+		return fmt.Errorf("day and night must be between 0 and 1")
+	}
+
+	c.fade = 10 * time.Minute
+	if c.Fade != "" {
+		d, err := time.ParseDuration(c.Fade)
+		if err != nil || d < 0 {
+			return fmt.Errorf("bad fade %q", c.Fade)
+		}
+		c.fade = d
+	}
+
+	sun := c.Latitude != nil || c.Longitude != nil
+	fixed := c.DayStart != "" || c.NightStart != ""
+	switch {
+	case sun && fixed:
+		return fmt.Errorf("use either day_start/night_start or latitude/longitude, not both")
+	case sun:
+		if c.Latitude == nil || c.Longitude == nil {
+			return fmt.Errorf("latitude and longitude are both required")
+		}
+	case fixed:
+		var err error
+		if c.dayStart, err = parseClock(c.DayStart); err != nil {
+			return fmt.Errorf("day_start: %v", err)
+		}
+		if c.nightStart, err = parseClock(c.NightStart); err != nil {
+			return fmt.Errorf("night_start: %v", err)
+		}
+	default:
+		return fmt.Errorf("set day_start and night_start, or latitude and longitude")
+	}
+	return nil
+}
+
+func parseClock(s string) (int, error) {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, fmt.Errorf("want HH:MM, got %q", s)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// IsDay reports whether the schedule has daytime at t.
+func (c *Config) IsDay(t time.Time) bool {
+	if c.Latitude != nil {
+		rise, set, polar := Sun(t, *c.Latitude, *c.Longitude)
+		if polar != 0 {
+			return polar > 0
+		}
+		return !t.Before(rise) && t.Before(set)
+	}
+	m := t.Hour()*60 + t.Minute()
+	if c.dayStart <= c.nightStart {
+		return c.dayStart <= m && m < c.nightStart
+	}
+	return m >= c.dayStart || m < c.nightStart
+}
+
+// Level returns the scheduled level at t.
+func (c *Config) Level(t time.Time) float64 {
+	if c.IsDay(t) {
+		return c.Day
+	}
+	return c.Night
+}
+
+// State is the controller state reported by the API.
+type State struct {
+	Level     float64    `json:"level"`     // current output level
+	Target    float64    `json:"target"`    // level being faded to
+	Scheduled float64    `json:"scheduled"` // level the schedule asks for
+	Override  *float64   `json:"override,omitempty"`
+	Until     *time.Time `json:"until,omitempty"` // end of the override
+}
+
+// Controller drives a screen.BrightnessControl from the schedule and
+// runtime overrides. cfg may be nil: no schedule, full brightness.
+type Controller struct {
+	cfg  *Config
+	ctrl *screen.BrightnessControl
+
+	mutex    sync.Mutex
+	override *float64
+	until    time.Time // zero: until cleared
+	applied  float64
+}
+
+func NewController(cfg *Config, ctrl *screen.BrightnessControl) *Controller {
+	c := &Controller{cfg: cfg, ctrl: ctrl, applied: -1}
+	c.apply(time.Now(), 0)
+	return c
+}
+
+func (c *Controller) scheduled(t time.Time) float64 {
+	if c.cfg == nil {
+		return 1
+	}
+	return c.cfg.Level(t)
+}
+
+// apply sets the control to what should be shown at t, if that changed.
+// Must not be called with c.mutex held.
+func (c *Controller) apply(t time.Time, fade time.Duration) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.override != nil && !c.until.IsZero() && !t.Before(c.until) {
+		c.override = nil
+		fade = overrideFade
+	}
+	level := c.scheduled(t)
+	if c.override != nil {
+		level = *c.override
+	}
+	if level != c.applied {
+		c.applied = level
+		c.ctrl.Set(level, fade)
+	}
+}
+
+// Run follows the schedule until the process exits.
+func (c *Controller) Run() {
+	fade := time.Duration(0)
+	if c.cfg != nil {
+		fade = c.cfg.fade
+	}
+	for range time.Tick(15 * time.Second) {
+		c.apply(time.Now(), fade)
+	}
+}
+
+// Override holds level until the given time (forever if zero) or Clear.
+func (c *Controller) Override(level float64, until time.Time) error {
+	if level < 0 || level > 1 {
+		return fmt.Errorf("level must be between 0 and 1")
+	}
+	c.mutex.Lock()
+	c.override, c.until = &level, until
+	c.mutex.Unlock()
+	c.apply(time.Now(), overrideFade)
+	return nil
+}
+
+// Clear ends an override; the schedule applies again.
+func (c *Controller) Clear() {
+	c.mutex.Lock()
+	c.override, c.until = nil, time.Time{}
+	c.mutex.Unlock()
+	c.apply(time.Now(), overrideFade)
+}
+
+// State returns the current state.
+func (c *Controller) State() State {
+	level, target := c.ctrl.Level()
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	s := State{Level: level, Target: target, Scheduled: c.scheduled(time.Now())}
+	if c.override != nil {
+		o := *c.override
+		s.Override = &o
+		if !c.until.IsZero() {
+			u := c.until
+			s.Until = &u
+		}
+	}
+	return s
+}
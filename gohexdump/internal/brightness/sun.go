@@ -0,0 +1,48 @@
+package brightness
+
+import (
+	"math"
+	"time"
+)
+
+// Sun returns sunrise and sunset for the day containing t (in t's
+// location) at the given coordinates, using the NOAA sunrise equation.
+// Accuracy is about a minute, plenty for dimming a display. At high
+// latitudes the sun may not rise or set: polar is then +1 for midnight
+// sun, -1 for polar night, and rise and set are zero.
+func Sun(t time.Time, latitude, longitude float64) (rise, set time.Time, polar int) {
+	const (
+		unixEpochJD = 2440587.5
+		j2000       = 2451545.0
+		rad         = math.Pi / 180
+	)
+
+	// Julian day number of local noon
+	y, m, d := t.Date()
+	noon := time.Date(y, m, d, 12, 0, 0, 0, t.Location())
+	jd := float64(noon.Unix())/86400 + unixEpochJD
+	n := math.Round(jd - j2000 + .0008)
+
+	jStar := n - longitude/360
+	M := math.Mod(357.5291+.98560028*jStar, 360)
+	C := 1.9148*math.Sin(M*rad) + .02*math.Sin(2*M*rad) + .0003*math.Sin(3*M*rad)
+	lambda := math.Mod(M+C+180+102.9372, 360)
+	transit := j2000 + jStar + .0053*math.Sin(M*rad) - .0069*math.Sin(2*lambda*rad)
+
+	sinDecl := math.Sin(lambda*rad) * math.Sin(23.4397*rad)
+	cosDecl := math.Cos(math.Asin(sinDecl))
+	cosHour := (math.Sin(-.833*rad) - math.Sin(latitude*rad)*sinDecl) / (math.Cos(latitude*rad) * cosDecl)
+	switch {
+	case cosHour < -1:
+		return time.Time{}, time.Time{}, 1
+	case cosHour > 1:
+		return time.Time{}, time.Time{}, -1
+	}
+	hour := math.Acos(cosHour) / rad
+
+	toTime := func(j float64) time.Time {
+		sec := (j - unixEpochJD) * 86400
+		return time.Unix(int64(sec), 0).In(t.Location())
+	}
+	return toTime(transit - hour/360), toTime(transit + hour/360), 0
+}
@@ -14,6 +14,7 @@ const Shift = cycleBits-tableBits
 const Mask = tableSize-1
 
 var Wave []float64
+var Square []float64
 
 func init() {
 	Wave = make([]float64, tableSize)
@@ -21,5 +22,11 @@ func init() {
 		t := float64(i)*2*math.Pi/float64(tableSize)
 		Wave[i] = math.Min(1, math.Max(0, .5*(1+math.Sin(t))))
 	}
+	Square = make([]float64, tableSize)
+	for i := range Square {
+		if i < tableSize/2 {
+			Square[i] = 1
+		}
+	}
 }
 
@@ -0,0 +1,83 @@
+// Package events is a small in-process event bus for board activity.
+// Producers (the display) Publish; integrations such as Hue, MQTT and
+// webhooks Subscribe. Each subscriber gets its own queue and goroutine, so a
+// slow subscriber never blocks the display or the others, and every
+// subscriber sees events in publish order.
+package events
+
+import (
+	"log"
+	"sync"
+	"time"
+)
+
+// Type identifies an event. The string values appear in webhook payloads.
+type Type string
+
+const (
+	MessageShown   Type = "message.shown"   // a message (or the last one again) is on the board
+	MessageExpired Type = "message.expired" // the message timeout ran out
+	Idle           Type = "idle"            // the board went back to idle rain
+	TimerStarted   Type = "timer.started"   // a countdown or stopwatch started; Message is its name
+	TimerDone      Type = "timer.done"      // a countdown reached zero; Message is its name
+	Blank          Type = "display.blank"   // the board faded out after inactivity
+	Wake           Type = "display.wake"    // input woke the blanked board
+)
+
+// Event is one occurrence of board activity.
+type Event struct {
+	Type    Type      `json:"type"`
+	Message string    `json:"message,omitempty"`
+	Time    time.Time `json:"time"`
+}
+
+// queueSize bounds each subscriber's backlog; events beyond it are dropped.
+const queueSize = 64
+
+// Bus fans events out to subscribers. The zero value is ready to use.
+type Bus struct {
+	mutex sync.Mutex
+	subs  []chan Event
+}
+
+// Subscribe calls fn for every event published from now on, in order,
+// on a goroutine dedicated to this subscriber.
+func (b *Bus) Subscribe(fn func(Event)) {
+	c := make(chan Event, queueSize)
+	go func() {
+		for e := range c {
+			fn(e)
+		}
+	}()
+	b.mutex.Lock()
+	b.subs = append(b.subs, c)
+	b.mutex.Unlock()
+}
+
+// Depth returns the number of events queued across all subscribers.
+func (b *Bus) Depth() int {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	n := 0
+	for _, c := range b.subs {
+		n += len(c)
+	}
+	return n
+}
+
+// Publish queues e for all subscribers without blocking. A zero Time is
+// set to now.
+func (b *Bus) Publish(e Event) {
+	if e.Time.IsZero() {
+		e.Time = time.Now().UTC()
+	}
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	for _, c := range b.subs {
+		select {
+		case c <- e:
+		default:
+			log.Printf("events: subscriber queue full, dropped %s", e.Type)
+		}
+	}
+}
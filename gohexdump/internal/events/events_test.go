@@ -0,0 +1,71 @@
+package events
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPublishOrder(t *testing.T) {
+	var bus Bus
+	got := make(chan Event, queueSize)
+	bus.Subscribe(func(e Event) { got <- e })
+
+	bus.Publish(Event{Type: MessageShown, Message: "one"})
+	bus.Publish(Event{Type: MessageShown, Message: "two"})
+	bus.Publish(Event{Type: Idle})
+	for _, want := range []string{"one", "two", ""} {
+		select {
+		case e := <-got:
+			if e.Message != want {
+				t.Errorf("event %+v, want message %q", e, want)
+			}
+			if e.Time.IsZero() {
+				t.Errorf("event %+v has no time", e)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("event %q not delivered", want)
+		}
+	}
+}
+
+func TestPublishDropsWhenFull(t *testing.T) {
+	var bus Bus
+	release := make(chan struct{})
+	started := make(chan struct{}, 1)
+	slow := make(chan Event, 2*queueSize)
+	bus.Subscribe(func(e Event) {
+		select {
+		case started <- struct{}{}:
+		default:
+		}
+		<-release
+		slow <- e
+	})
+
+	// the slow subscriber takes one event and blocks on it
+	bus.Publish(Event{Type: Idle})
+	<-started
+
+	const extra = 10
+	for i := 0; i < queueSize+extra; i++ {
+		bus.Publish(Event{Type: MessageShown})
+	}
+	if d := bus.Depth(); d != queueSize {
+		t.Errorf("Depth = %d, want a full queue of %d", d, queueSize)
+	}
+
+	close(release)
+	want := 1 + queueSize
+	for i := 0; i < want; i++ {
+		select {
+		case <-slow:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("slow subscriber got %d events, want %d", i, want)
+		}
+	}
+	select {
+	case e := <-slow:
+		t.Errorf("slow subscriber got %+v beyond its queue", e)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
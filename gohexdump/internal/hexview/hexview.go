@@ -0,0 +1,203 @@
+// Package hexview renders pages of bytes onto a HexScreen in the classic
+// hexdump layout: a title row, then an offset column, 16 hex fields and 16
+// ASCII fields per line. It is shared by the hexview, hexdiff and hexsniff
+// commands.
+//
+// The layout is larger than the board, which shows only its top-left
+// corner; Visible tells how much of it reaches the display, and Scroll
+// keeps a byte in that part.
+package hexview
+
+import (
+	"fmt"
+
+	"post6.net/gohexdump/internal/screen"
+)
+
+// A page is what the layout holds: 240 bytes, not 256, since the title row
+// leaves room for 15 lines of 16.
+const (
+	LineSize = 16
+	Lines    = 15 // data lines, below the title row
+	PageSize = Lines * LineSize
+)
+
+// titleRows are the HexScreen lines above the data.
+const titleRows = 1
+
+// Styles used by Render. Per-byte overrides come from the style callback.
+type Styles struct {
+	Title  screen.Style
+	Offset screen.Style
+	Byte   screen.Style
+}
+
+// DefaultStyles is a dim layout that leaves headroom for highlights.
+func DefaultStyles() Styles {
+	return Styles{
+		Title:  screen.NewBrightness(.6),
+		Offset: screen.NewBrightness(.2),
+		Byte:   screen.NewBrightness(.35),
+	}
+}
+
+// View draws pages onto a HexScreen.
+type View struct {
+	s      screen.HexScreen
+	Styles Styles
+
+	// Left is the first byte of each line drawn in the first hex field,
+	// for boards too narrow for a whole line; see Scroll.
+	Left int
+
+	lines, fields int // visible data lines and hex fields per line
+}
+
+func New(s screen.HexScreen) *View {
+	v := &View{s: s, Styles: DefaultStyles()}
+	for v.lines < Lines && v.visible(v.slot(v.lines, 0)) {
+		v.lines++
+	}
+	for v.fields < LineSize && v.visible(v.slot(0, v.fields)) {
+		v.fields++
+	}
+	if v.lines == 0 {
+		v.lines = 1
+	}
+	if v.fields == 0 {
+		v.fields = 1
+	}
+	return v
+}
+
+// slot is the HexScreen field that shows column col of data line line.
+func (v *View) slot(line, col int) int {
+	return (line+titleRows)*LineSize + col
+}
+
+// visible reports whether both digits of hex field slot are on the display.
+func (v *View) visible(slot int) bool {
+	x, y := v.s.HexFieldPosition(slot)
+	return v.s.DigitIndex(x, y) != -1 && v.s.DigitIndex(x+1, y) != -1
+}
+
+// Visible returns the number of data lines, and of bytes per line, that
+// reach the display.
+func (v *View) Visible() (lines, bytes int) {
+	return v.lines, v.fields
+}
+
+// Scroll returns the offset of the first line to show, starting from top,
+// so that byte pos is on the display, and moves Left to keep its column in
+// view. Both move as little as they can.
+func (v *View) Scroll(top, pos int64) int64 {
+	line := pos - pos%LineSize
+	if line < top {
+		top = line
+	} else if last := top + int64((v.lines-1)*LineSize); line > last {
+		top += line - last
+	}
+	col := int(pos % LineSize)
+	if col < v.Left {
+		v.Left = col
+	} else if col >= v.Left+v.fields {
+		v.Left = col - v.fields + 1
+	}
+	return top
+}
+
+// field returns the hex field that shows byte i of the page, or -1 if it
+// is scrolled out sideways or past the last line.
+func (v *View) field(i int) int {
+	line, col := i/LineSize, i%LineSize-v.Left
+	if i < 0 || line >= Lines || col < 0 || col >= LineSize {
+		return -1
+	}
+	return v.slot(line, col)
+}
+
+// Screen returns the underlying HexScreen.
+func (v *View) Screen() screen.HexScreen {
+	return v.s
+}
+
+// Render draws up to PageSize bytes of data as the page starting at file
+// offset base, from byte Left of each line, with title on the title row.
+// The offsets are those of the first byte shown on each line. style, if
+// not nil, may return a style for byte i of the page; nil falls back to
+// Styles.Byte. Fields past the end of data are blanked. The update is
+// atomic (Hold/Update).
+func (v *View) Render(title string, base int64, data []byte, style func(i int) screen.Style) {
+	s := v.s
+	s.Hold()
+	defer s.Update()
+
+	s.SetStyle(v.Styles.Title)
+	s.WriteTitle(fmt.Sprintf("%-64s", title), 0)
+
+	for line := 0; line < Lines; line++ {
+		s.SetStyle(v.Styles.Offset)
+		if first := line*LineSize + v.Left; first < len(data) {
+			s.WriteOffset(fmt.Sprintf("%08X", base+int64(first)), line+titleRows)
+		} else {
+			s.WriteOffset("        ", line+titleRows)
+		}
+
+		for col := 0; col < LineSize; col++ {
+			slot := v.slot(line, col)
+			i := line*LineSize + v.Left + col
+			if col >= LineSize-v.Left || i >= len(data) {
+				s.SetStyle(v.Styles.Byte)
+				s.WriteHexField("  ", slot)
+				s.WriteAsciiField(" ", slot)
+				continue
+			}
+			st := v.Styles.Byte
+			if style != nil {
+				if o := style(i); o != nil {
+					st = o
+				}
+			}
+			s.SetStyle(st)
+			s.WriteHexField(fmt.Sprintf("%02X", data[i]), slot)
+			s.WriteAsciiField(string(printable(data[i])), slot)
+		}
+	}
+}
+
+// Title rewrites only the title row.
+func (v *View) Title(title string) {
+	v.s.SetStyle(v.Styles.Title)
+	v.s.WriteTitle(fmt.Sprintf("%-64s", title), 0)
+}
+
+// Position returns the column and row of the first digit of byte i's hex
+// field, or -1, -1 if byte i is not drawn.
+func (v *View) Position(i int) (int, int) {
+	f := v.field(i)
+	if f == -1 {
+		return -1, -1
+	}
+	return v.s.HexFieldPosition(f)
+}
+
+// Origin returns the screen coordinate of byte i's hex field, e.g. as a
+// ripple origin. ok is false if the field is not on the display.
+func (v *View) Origin(i int) (origin screen.Vector2, ok bool) {
+	f := v.field(i)
+	if f == -1 {
+		return origin, false
+	}
+	ix := v.s.DigitIndex(v.s.HexFieldPosition(f))
+	if ix == -1 {
+		return origin, false
+	}
+	return v.s.SegmentCoord(ix*16 + 3), true
+}
+
+func printable(b byte) rune {
+	if b < 0x20 || b > 0x7e {
+		return '.'
+	}
+	return rune(b)
+}
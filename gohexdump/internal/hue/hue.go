@@ -1,29 +1,132 @@
 // Package hue provides Philips Hue bridge integration for hexboard.
-// It reads a TOML config at /var/lib/hexboard/hue.toml and exposes
-// a TurnOn() method that fires a non-blocking PUT to the Hue v1 CLIP API.
+// It reads a TOML config at /var/lib/hexboard/hue.toml and applies the
+// configured actions through the Hue CLIP API (v1, or v2 — see v2.go):
+// one when a message is shown (MessageShown), chosen by the message text,
+// and one when the board returns to idle (Idle), driven by the board's
+// event bus (Subscribe). With v2, bridge events can also trigger board
+// actions (Watch).
 package hue
 
 import (
 	"bytes"
 	"encoding/json"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"log"
 	"net/http"
 	"os"
+	"regexp"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/BurntSushi/toml"
+
+	"post6.net/gohexdump/internal/events"
+	"post6.net/gohexdump/internal/metrics"
 )
 
 const configPath = "/var/lib/hexboard/hue.toml"
 
-// Config holds the Hue connection parameters read from hue.toml.
-// All three fields must be non-empty for Hue to be active.
+// Config holds the Hue connection parameters and actions read from hue.toml.
+// BridgeIP and APIKey are required. DeviceID is the default light for
+// actions that name neither a light nor a group.
 type Config struct {
 	BridgeIP string `toml:"bridge_ip"`
 	APIKey   string `toml:"api_key"`
 	DeviceID string `toml:"device_id"`
+
+	// APIVersion selects the CLIP API: 1 (default) or 2.
+	APIVersion int `toml:"api_version"`
+
+	// BridgeID is the bridge's ID, the name in its certificate; required
+	// with API version 2. BridgeCA is a PEM file of CAs to trust instead of
+	// the Signify root (see v2.go).
+	BridgeID string `toml:"bridge_id"`
+	BridgeCA string `toml:"bridge_ca"`
+
+	// OnMessage is applied each time a message is displayed that no
+	// Messages rule matches. Defaults to turning DeviceID on.
+	OnMessage *Action `toml:"on_message"`
+
+	// Messages choose an action by the message text: the first rule that
+	// matches is applied instead of OnMessage.
+	Messages []MessageRule `toml:"message"`
+
+	// OnIdle is applied when the board goes back to raindrops.
+	// Nil leaves the light as it is.
+	OnIdle *IdleAction `toml:"on_idle"`
+
+	// Triggers map bridge events to board actions (v2 only).
+	Triggers []Trigger `toml:"trigger"`
+
+	v2Client *http.Client // requests, with a timeout
+	v2Stream *http.Client // the event stream, without
+
+	mutex   sync.Mutex
+	saved   []savedState // state of each target before its first action, for IdleRestore
+	applied *Action      // last action applied, whose target Idle acts on
+}
+
+// Action is a state change for one light or group. Unset fields are left
+// alone by the bridge. When Scene is set it is recalled on Group (or on the
+// all-lights group 0) and the remaining fields are applied afterwards.
+type Action struct {
+	Light string `toml:"light"`
+	Group string `toml:"group"`
+	Scene string `toml:"scene"`
+
+	On         *bool     `toml:"on"`
+	Brightness *int      `toml:"brightness"` // 1–254
+	Hue        *int      `toml:"hue"`        // 0–65535
+	Sat        *int      `toml:"sat"`        // 0–254
+	XY         []float64 `toml:"xy"`         // CIE [x, y]
+	CT         *int      `toml:"ct"`         // mired, 153–500
+
+	// Transition is the fade time in units of 100 ms (Hue default is 4).
+	Transition *int `toml:"transition"`
+}
+
+// MessageRule applies its action to messages matching Match, a regular
+// expression matched case-insensitively anywhere in the message.
+type MessageRule struct {
+	Match string `toml:"match"`
+	Action
+
+	re *regexp.Regexp
+}
+
+// Idle modes.
+const (
+	IdleOff     = "off"     // turn the target off
+	IdleRestore = "restore" // put back the state from before the first message
+)
+
+// IdleAction describes what happens when the board returns to idle.
+// Target selection falls back to the light/group of the last message
+// action, then DeviceID.
+type IdleAction struct {
+	Mode       string `toml:"mode"`
+	Light      string `toml:"light"`
+	Group      string `toml:"group"`
+	Transition *int   `toml:"transition"`
+}
+
+// savedState is the subset of a light's (or group's) state we can restore.
+type savedState struct {
+	path  string // e.g. "lights/3/state" or "groups/1/action"
+	state lightState
+}
+
+type lightState struct {
+	On        bool      `json:"on"`
+	Bri       int       `json:"bri"`
+	Hue       int       `json:"hue"`
+	Sat       int       `json:"sat"`
+	XY        []float64 `json:"xy"`
+	CT        int       `json:"ct"`
+	ColorMode string    `json:"colormode"`
 }
 
 // LoadConfig reads /var/lib/hexboard/hue.toml.
@@ -39,27 +142,324 @@ func LoadConfig() (*Config, error) {
 		}
 		return nil, err
 	}
-	if cfg.BridgeIP == "" || cfg.APIKey == "" || cfg.DeviceID == "" {
-		return nil, fmt.Errorf("hue.toml: bridge_ip, api_key, and device_id are all required")
+	if err := cfg.validate(); err != nil {
+		return nil, fmt.Errorf("hue.toml: %v", err)
 	}
 	return &cfg, nil
 }
 
+func (c *Config) validate() error {
+	if c.BridgeIP == "" || c.APIKey == "" {
+		return fmt.Errorf("bridge_ip and api_key are required")
+	}
+	switch c.APIVersion {
+	case 0:
+		c.APIVersion = 1
+	case 1, 2:
+	default:
+		return fmt.Errorf("api_version must be 1 or 2")
+	}
+	if c.OnMessage == nil {
+		on := true
+		c.OnMessage = &Action{On: &on}
+	}
+	if err := c.checkAction("on_message", c.OnMessage); err != nil {
+		return err
+	}
+	for i := range c.Messages {
+		m := &c.Messages[i]
+		name := fmt.Sprintf("message %d", i+1)
+		if m.Match == "" {
+			return fmt.Errorf("%s: match is required", name)
+		}
+		re, err := regexp.Compile("(?i)" + m.Match)
+		if err != nil {
+			return fmt.Errorf("%s: match: %v", name, err)
+		}
+		m.re = re
+		if err := c.checkAction(name, &m.Action); err != nil {
+			return err
+		}
+	}
+	if c.APIVersion != 2 && len(c.Triggers) > 0 {
+		return fmt.Errorf("trigger requires api_version = 2")
+	}
+	if c.APIVersion == 2 {
+		if err := c.v2Setup(); err != nil {
+			return err
+		}
+	}
+	for _, t := range c.Triggers {
+		if t.Resource == "" || t.Event == "" {
+			return fmt.Errorf("trigger: resource and event are required")
+		}
+	}
+	if i := c.OnIdle; i != nil {
+		if i.Mode != IdleOff && i.Mode != IdleRestore {
+			return fmt.Errorf("on_idle.mode must be %q or %q", IdleOff, IdleRestore)
+		}
+	}
+	return nil
+}
+
+func (c *Config) checkAction(name string, a *Action) error {
+	if a.Light == "" && a.Group == "" && a.Scene == "" && c.DeviceID == "" {
+		return fmt.Errorf("device_id is required unless %s names a light, group, or scene", name)
+	}
+	if a.XY != nil && len(a.XY) != 2 {
+		return fmt.Errorf("%s: xy must be [x, y]", name)
+	}
+	if c.APIVersion == 2 && (a.Hue != nil || a.Sat != nil) {
+		return fmt.Errorf("%s: hue/sat are not available with api_version = 2, use xy", name)
+	}
+	return nil
+}
+
+// action returns the action for msg: the first matching rule's, or
+// OnMessage.
+func (c *Config) action(msg string) *Action {
+	for i := range c.Messages {
+		if c.Messages[i].re.MatchString(msg) {
+			return &c.Messages[i].Action
+		}
+	}
+	return c.OnMessage
+}
+
+// target returns the v1 API path for an action's light or group.
+func (c *Config) target(light, group string) string {
+	if group != "" {
+		return "groups/" + group + "/action"
+	}
+	if light == "" {
+		light = c.DeviceID
+	}
+	return "lights/" + light + "/state"
+}
+
+// hueRequests counts bridge calls by outcome: "ok", or "error" for network
+// failures and non-200 responses.
+var hueRequests = metrics.NewCounterVec("hexboard_hue_requests_total",
+	"Hue bridge requests, by result.", "result", "ok", "error")
+
+// result records the outcome of one bridge request.
+func result(err error) {
+	if err != nil {
+		hueRequests.With("error").Inc()
+	} else {
+		hueRequests.With("ok").Inc()
+	}
+}
+
 // hueClient has a 5-second timeout to prevent goroutine leak when bridge is unreachable.
 var hueClient = &http.Client{Timeout: 5 * time.Second}
 
-// TurnOn sends a PUT to the Hue bridge to turn the configured light on.
-// Designed to be called as: go cfg.TurnOn()
-// Logs and returns silently on any error — never blocks the caller.
-func (c *Config) TurnOn() {
-	body, err := json.Marshal(map[string]bool{"on": true})
+// Subscribe applies MessageShown and Idle as the corresponding events
+// arrive on bus. The bus runs them on their own goroutine, in order.
+func (c *Config) Subscribe(bus *events.Bus) {
+	bus.Subscribe(func(e events.Event) {
+		switch e.Type {
+		case events.MessageShown:
+			c.MessageShown(e.Message)
+		case events.Idle:
+			c.Idle()
+		}
+	})
+}
+
+// MessageShown applies the action for msg. The first time a target is
+// touched after idle, its current state is captured so Idle can restore it.
+// Logs and returns silently on any error.
+func (c *Config) MessageShown(msg string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	a := c.action(msg)
+	c.applied = a
+	if c.APIVersion == 2 {
+		c.v2MessageShown(a)
+		return
+	}
+
+	if c.OnIdle != nil && c.OnIdle.Mode == IdleRestore {
+		if path := c.idleTarget(); !c.isSaved(path) {
+			st, err := c.getState(path)
+			result(err)
+			if err != nil {
+				log.Printf("hue: save state: %v", err)
+			} else {
+				c.saved = append(c.saved, savedState{path: path, state: st})
+			}
+		}
+	}
+
+	if a.Scene != "" {
+		group := a.Group
+		if group == "" {
+			group = "0"
+		}
+		scene := map[string]interface{}{"scene": a.Scene}
+		if a.Transition != nil {
+			scene["transitiontime"] = *a.Transition
+		}
+		c.put("groups/"+group+"/action", scene)
+	}
+
+	body := map[string]interface{}{}
+	if a.On != nil {
+		body["on"] = *a.On
+	}
+	if a.Brightness != nil {
+		body["bri"] = *a.Brightness
+	}
+	if a.Hue != nil {
+		body["hue"] = *a.Hue
+	}
+	if a.Sat != nil {
+		body["sat"] = *a.Sat
+	}
+	if a.XY != nil {
+		body["xy"] = a.XY
+	}
+	if a.CT != nil {
+		body["ct"] = *a.CT
+	}
+	if len(body) > 0 {
+		if a.Transition != nil {
+			body["transitiontime"] = *a.Transition
+		}
+		c.put(c.messageTarget(a), body)
+	}
+}
+
+// messageTarget is the v1 path the fields of a are applied to: its light
+// or group, the group a scene was recalled on, or DeviceID.
+func (c *Config) messageTarget(a *Action) string {
+	if a.Scene != "" && a.Light == "" && a.Group == "" {
+		return c.target("", "0")
+	}
+	return c.target(a.Light, a.Group)
+}
+
+// Idle applies OnIdle: turns the target off or restores the states captured
+// by MessageShown. Does nothing when OnIdle is not configured.
+func (c *Config) Idle() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	i := c.OnIdle
+	if i == nil {
+		return
+	}
+	defer func() { c.applied = nil }()
+	if c.APIVersion == 2 {
+		c.v2Idle()
+		return
+	}
+
+	switch i.Mode {
+	case IdleOff:
+		body := map[string]interface{}{"on": false}
+		if i.Transition != nil {
+			body["transitiontime"] = *i.Transition
+		}
+		c.put(c.idleTarget(), body)
+
+	case IdleRestore:
+		for _, saved := range c.saved {
+			s := saved.state
+			body := map[string]interface{}{"on": s.On}
+			if s.On {
+				body["bri"] = s.Bri
+				switch s.ColorMode {
+				case "hs":
+					body["hue"], body["sat"] = s.Hue, s.Sat
+				case "xy":
+					body["xy"] = s.XY
+				case "ct":
+					body["ct"] = s.CT
+				}
+			}
+			if i.Transition != nil {
+				body["transitiontime"] = *i.Transition
+			}
+			c.put(saved.path, body)
+		}
+		c.saved = nil
+	}
+}
+
+// isSaved reports whether the state of path has been captured since idle.
+func (c *Config) isSaved(path string) bool {
+	for _, s := range c.saved {
+		if s.path == path {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *Config) idleTarget() string {
+	i := c.OnIdle
+	if i.Light != "" || i.Group != "" {
+		return c.target(i.Light, i.Group)
+	}
+	return c.messageTarget(c.lastAction())
+}
+
+// lastAction is the action whose target idle acts on: the one applied
+// since idle, or OnMessage.
+func (c *Config) lastAction() *Action {
+	if c.applied != nil {
+		return c.applied
+	}
+	return c.OnMessage
+}
+
+func (c *Config) url(path string) string {
+	bridgeIP := strings.TrimRight(c.BridgeIP, "/")
+	return fmt.Sprintf("http://%s/api/%s/%s", bridgeIP, c.APIKey, path)
+}
+
+// getState reads the current state for a "lights/<id>/state" or
+// "groups/<id>/action" path.
+func (c *Config) getState(path string) (lightState, error) {
+	var st lightState
+	resource := path[:strings.LastIndex(path, "/")]
+	resp, err := hueClient.Get(c.url(resource))
+	if err != nil {
+		return st, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return st, fmt.Errorf("get %s: %s", resource, resp.Status)
+	}
+	var v struct {
+		State  *lightState `json:"state"`
+		Action *lightState `json:"action"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&v); err != nil {
+		return st, err
+	}
+	switch {
+	case v.State != nil:
+		st = *v.State
+	case v.Action != nil:
+		st = *v.Action
+	default:
+		return st, fmt.Errorf("get %s: no state in response", resource)
+	}
+	return st, nil
+}
+
+// put sends body as JSON to path. Errors are logged, not returned.
+func (c *Config) put(path string, body interface{}) {
+	data, err := json.Marshal(body)
 	if err != nil {
 		log.Printf("hue: marshal: %v", err)
 		return
 	}
-	bridgeIP := strings.TrimRight(c.BridgeIP, "/")
-	url := fmt.Sprintf("http://%s/api/%s/lights/%s/state", bridgeIP, c.APIKey, c.DeviceID)
-	req, err := http.NewRequest(http.MethodPut, url, bytes.NewReader(body))
+	req, err := http.NewRequest(http.MethodPut, c.url(path), bytes.NewReader(data))
 	if err != nil {
 		log.Printf("hue: request: %v", err)
 		return
@@ -67,8 +467,15 @@ func (c *Config) TurnOn() {
 	req.Header.Set("Content-Type", "application/json")
 	resp, err := hueClient.Do(req)
 	if err != nil {
+		result(err)
 		log.Printf("hue: put: %v", err)
 		return
 	}
+	io.Copy(ioutil.Discard, resp.Body)
 	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		err = fmt.Errorf("put %s: %s", path, resp.Status)
+		log.Printf("hue: %v", err)
+	}
+	result(err)
 }
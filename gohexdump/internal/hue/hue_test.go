@@ -0,0 +1,324 @@
+package hue
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/BurntSushi/toml"
+)
+
+// request is one call received by fakeBridge.
+type request struct {
+	Method string
+	Path   string
+	Key    string // hue-application-key header
+	Body   map[string]interface{}
+}
+
+// fakeBridge records the requests it gets and answers GETs from state,
+// keyed by path.
+type fakeBridge struct {
+	*httptest.Server
+	mutex    sync.Mutex
+	requests []request
+	state    map[string]string
+}
+
+func newFakeBridge(tls bool) *fakeBridge {
+	b := &fakeBridge{state: make(map[string]string)}
+	h := http.HandlerFunc(b.serve)
+	if tls {
+		b.Server = httptest.NewTLSServer(h)
+	} else {
+		b.Server = httptest.NewServer(h)
+	}
+	return b
+}
+
+func (b *fakeBridge) serve(w http.ResponseWriter, r *http.Request) {
+	req := request{Method: r.Method, Path: r.URL.Path, Key: r.Header.Get("hue-application-key")}
+	if data, _ := ioutil.ReadAll(r.Body); len(data) > 0 {
+		json.Unmarshal(data, &req.Body)
+	}
+	b.mutex.Lock()
+	b.requests = append(b.requests, req)
+	state, ok := b.state[r.URL.Path]
+	b.mutex.Unlock()
+
+	if r.Method == http.MethodGet {
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(state))
+		return
+	}
+	w.Write([]byte(`[{"success":{}}]`))
+}
+
+// setState sets the answer to GET path; empty removes it.
+func (b *fakeBridge) setState(path, state string) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if state == "" {
+		delete(b.state, path)
+	} else {
+		b.state[path] = state
+	}
+}
+
+// take returns the requests received since the last call.
+func (b *fakeBridge) take() []request {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	r := b.requests
+	b.requests = nil
+	return r
+}
+
+// host is the bridge address as hue.toml gives it.
+func (b *fakeBridge) host() string {
+	return strings.TrimPrefix(b.URL, "http://")
+}
+
+func parseConfig(t *testing.T, text string) *Config {
+	t.Helper()
+	var c Config
+	if _, err := toml.Decode(text, &c); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.validate(); err != nil {
+		t.Fatal(err)
+	}
+	return &c
+}
+
+// body builds the expected JSON body, as decoded from the wire.
+func body(kv ...interface{}) map[string]interface{} {
+	m := make(map[string]interface{})
+	for i := 0; i < len(kv); i += 2 {
+		data, _ := json.Marshal(kv[i+1])
+		var v interface{}
+		json.Unmarshal(data, &v)
+		m[kv[i].(string)] = v
+	}
+	return m
+}
+
+func checkRequests(t *testing.T, got []request, want ...request) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Fatalf("got %d requests %+v, want %d %+v", len(got), got, len(want), want)
+	}
+	for i := range want {
+		if got[i].Method != want[i].Method || got[i].Path != want[i].Path ||
+			(want[i].Body != nil && !reflect.DeepEqual(got[i].Body, want[i].Body)) {
+			t.Errorf("request %d = %s %s %v, want %s %s %v", i,
+				got[i].Method, got[i].Path, got[i].Body, want[i].Method, want[i].Path, want[i].Body)
+		}
+	}
+}
+
+func put(path string, b map[string]interface{}) request {
+	return request{Method: http.MethodPut, Path: path, Body: b}
+}
+
+func get(path string) request {
+	return request{Method: http.MethodGet, Path: path}
+}
+
+func TestDefaultTurnsOn(t *testing.T) {
+	b := newFakeBridge(false)
+	defer b.Close()
+	c := parseConfig(t, `bridge_ip = "`+b.host()+`"
+api_key = "key"
+device_id = "3"`)
+
+	c.MessageShown("hello")
+	checkRequests(t, b.take(), put("/api/key/lights/3/state", body("on", true)))
+
+	c.Idle() // no on_idle: nothing happens
+	checkRequests(t, b.take())
+}
+
+func TestActionBodies(t *testing.T) {
+	b := newFakeBridge(false)
+	defer b.Close()
+	c := parseConfig(t, `bridge_ip = "`+b.host()+`"
+api_key = "key"
+device_id = "3"
+
+[on_message]
+on = true
+brightness = 200
+xy = [0.31, 0.33]
+transition = 10
+
+[[message]]
+match = "^alert"
+group = "2"
+brightness = 254
+hue = 0
+sat = 254
+
+[[message]]
+match = "movie"
+scene = "Dim"
+group = "1"
+transition = 20
+
+[[message]]
+match = "party"
+scene = "Party"
+brightness = 100
+`)
+
+	c.MessageShown("plain message")
+	checkRequests(t, b.take(), put("/api/key/lights/3/state",
+		body("on", true, "bri", 200, "xy", []float64{.31, .33}, "transitiontime", 10)))
+
+	c.MessageShown("ALERT: disk full") // case-insensitive
+	checkRequests(t, b.take(), put("/api/key/groups/2/action",
+		body("bri", 254, "hue", 0, "sat", 254)))
+
+	c.MessageShown("not an alert") // anchored: falls back to on_message
+	checkRequests(t, b.take(), put("/api/key/lights/3/state", nil))
+
+	c.MessageShown("movie night")
+	checkRequests(t, b.take(), put("/api/key/groups/1/action", body("scene", "Dim", "transitiontime", 20)))
+
+	c.MessageShown("party time") // scene on all lights, then the fields
+	checkRequests(t, b.take(),
+		put("/api/key/groups/0/action", body("scene", "Party")),
+		put("/api/key/groups/0/action", body("bri", 100)))
+}
+
+func TestIdleOff(t *testing.T) {
+	b := newFakeBridge(false)
+	defer b.Close()
+	c := parseConfig(t, `bridge_ip = "`+b.host()+`"
+api_key = "key"
+device_id = "3"
+
+[[message]]
+match = "meeting"
+group = "4"
+on = true
+
+[on_idle]
+mode = "off"
+transition = 30
+`)
+
+	c.MessageShown("hello")
+	c.Idle()
+	checkRequests(t, b.take(),
+		put("/api/key/lights/3/state", body("on", true)),
+		put("/api/key/lights/3/state", body("on", false, "transitiontime", 30)))
+
+	// idle turns off what the last message turned on
+	c.MessageShown("meeting in 5")
+	c.Idle()
+	checkRequests(t, b.take(),
+		put("/api/key/groups/4/action", body("on", true)),
+		put("/api/key/groups/4/action", body("on", false, "transitiontime", 30)))
+}
+
+func TestIdleRestore(t *testing.T) {
+	b := newFakeBridge(false)
+	defer b.Close()
+	b.setState("/api/key/lights/3", `{"state":{"on":true,"bri":80,"xy":[0.5,0.4],"colormode":"xy"}}`)
+	c := parseConfig(t, `bridge_ip = "`+b.host()+`"
+api_key = "key"
+device_id = "3"
+
+[on_message]
+brightness = 254
+ct = 300
+
+[on_idle]
+mode = "restore"
+`)
+
+	c.MessageShown("first")
+	c.MessageShown("second") // state is saved before the first only
+	checkRequests(t, b.take(),
+		get("/api/key/lights/3"),
+		put("/api/key/lights/3/state", body("bri", 254, "ct", 300)),
+		put("/api/key/lights/3/state", nil))
+
+	c.Idle()
+	checkRequests(t, b.take(), put("/api/key/lights/3/state",
+		body("on", true, "bri", 80, "xy", []float64{.5, .4})))
+
+	c.Idle() // nothing saved any more
+	checkRequests(t, b.take())
+
+	// an unreachable state is not restored
+	b.setState("/api/key/lights/3", "")
+	c.MessageShown("third")
+	c.Idle()
+	checkRequests(t, b.take(), get("/api/key/lights/3"), put("/api/key/lights/3/state", nil))
+}
+
+func TestValidateMessageRules(t *testing.T) {
+	for _, text := range []string{
+		"[[message]]\nbrightness = 10",           // no match
+		"[[message]]\nmatch = \"(\"\non = true",  // bad regexp
+		"[[message]]\nmatch = \"x\"\nxy = [0.1]", // bad xy
+	} {
+		var c Config
+		if _, err := toml.Decode("bridge_ip = \"b\"\napi_key = \"k\"\ndevice_id = \"1\"\n"+text, &c); err != nil {
+			t.Fatal(err)
+		}
+		if err := c.validate(); err == nil {
+			t.Errorf("validate accepted %q", text)
+		}
+	}
+}
+
+func TestIdleRestoreEveryTarget(t *testing.T) {
+	b := newFakeBridge(false)
+	defer b.Close()
+	b.setState("/api/key/lights/3", `{"state":{"on":false,"bri":1,"colormode":"ct"}}`)
+	b.setState("/api/key/groups/2", `{"action":{"on":true,"bri":50,"ct":400,"colormode":"ct"}}`)
+	c := parseConfig(t, `bridge_ip = "`+b.host()+`"
+api_key = "key"
+device_id = "3"
+
+[[message]]
+match = "alert"
+group = "2"
+on = true
+
+[on_idle]
+mode = "restore"
+`)
+
+	c.MessageShown("first")
+	c.MessageShown("ALERT")
+	c.MessageShown("second")
+	c.MessageShown("alert again") // both saved already
+	checkRequests(t, b.take(),
+		get("/api/key/lights/3"),
+		put("/api/key/lights/3/state", body("on", true)),
+		get("/api/key/groups/2"),
+		put("/api/key/groups/2/action", body("on", true)),
+		put("/api/key/lights/3/state", body("on", true)),
+		put("/api/key/groups/2/action", body("on", true)))
+
+	c.Idle()
+	checkRequests(t, b.take(),
+		put("/api/key/lights/3/state", body("on", false)),
+		put("/api/key/groups/2/action", body("on", true, "bri", 50, "ct", 400)))
+
+	// after idle the states are captured afresh
+	c.MessageShown("ALERT")
+	checkRequests(t, b.take(), get("/api/key/groups/2"), put("/api/key/groups/2/action", body("on", true)))
+}
@@ -0,0 +1,372 @@
+package hue
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/BurntSushi/toml"
+)
+
+func v2Config(t *testing.T, b *fakeBridge, rest string) *Config {
+	t.Helper()
+	return v2Parse(t, b.Server, rest)
+}
+
+// v2Parse parses a v2 config for srv, trusting its certificate. The test
+// certificate is for example.com.
+func v2Parse(t *testing.T, srv *httptest.Server, rest string) *Config {
+	t.Helper()
+	ca := writeCA(t, srv)
+	defer os.Remove(ca)
+	return parseConfig(t, `bridge_ip = "`+srv.URL+`"
+bridge_id = "example.com"
+bridge_ca = "`+ca+`"
+api_key = "key"
+api_version = 2
+`+rest)
+}
+
+// writeCA writes the certificate of srv to a PEM file.
+func writeCA(t *testing.T, srv *httptest.Server) string {
+	t.Helper()
+	f, err := ioutil.TempFile("", "hue-ca")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if err := pem.Encode(f, &pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw}); err != nil {
+		os.Remove(f.Name())
+		t.Fatal(err)
+	}
+	return f.Name()
+}
+
+func TestV2Requests(t *testing.T) {
+	b := newFakeBridge(true)
+	defer b.Close()
+	c := v2Config(t, b, `device_id = "lamp"
+
+[on_message]
+on = true
+brightness = 127
+xy = [0.31, 0.33]
+transition = 10
+
+[[message]]
+match = "movie"
+scene = "cosy"
+group = "living"
+ct = 400
+`)
+
+	c.MessageShown("hello")
+	got := b.take()
+	checkRequests(t, got, put("/clip/v2/resource/light/lamp", body(
+		"on", map[string]bool{"on": true},
+		"dimming", map[string]float64{"brightness": 50},
+		"color", map[string]interface{}{"xy": map[string]float64{"x": .31, "y": .33}},
+		"dynamics", map[string]int{"duration": 1000})))
+	for _, r := range got {
+		if r.Key != "key" {
+			t.Errorf("hue-application-key = %q, want %q", r.Key, "key")
+		}
+	}
+
+	c.MessageShown("movie time")
+	checkRequests(t, b.take(),
+		put("/clip/v2/resource/scene/cosy", body("recall", map[string]string{"action": "active"})),
+		put("/clip/v2/resource/grouped_light/living", body("color_temperature", map[string]int{"mirek": 400})))
+}
+
+func TestV2NoTarget(t *testing.T) {
+	b := newFakeBridge(true)
+	defer b.Close()
+	c := v2Config(t, b, `
+[on_message]
+scene = "cosy"
+brightness = 254
+
+[on_idle]
+mode = "off"
+`)
+
+	// the scene is recalled, but there is no light for the brightness
+	c.MessageShown("hello")
+	checkRequests(t, b.take(), put("/clip/v2/resource/scene/cosy", nil))
+
+	c.Idle()
+	checkRequests(t, b.take())
+}
+
+func TestV2IdleRestore(t *testing.T) {
+	b := newFakeBridge(true)
+	defer b.Close()
+	b.setState("/clip/v2/resource/light/lamp", `{"data":[{"on":{"on":true},"dimming":{"brightness":40},
+		"color":{"xy":{"x":0.5,"y":0.4}},"color_temperature":{"mirek":null,"mirek_valid":false}}]}`)
+	c := v2Config(t, b, `device_id = "lamp"
+
+[on_idle]
+mode = "restore"
+transition = 5
+`)
+
+	c.MessageShown("hello")
+	checkRequests(t, b.take(),
+		get("/clip/v2/resource/light/lamp"),
+		put("/clip/v2/resource/light/lamp", body("on", map[string]bool{"on": true})))
+
+	c.Idle()
+	checkRequests(t, b.take(), put("/clip/v2/resource/light/lamp", body(
+		"on", map[string]bool{"on": true},
+		"dimming", map[string]float64{"brightness": 40},
+		"color", map[string]interface{}{"xy": map[string]float64{"x": .5, "y": .4}},
+		"dynamics", map[string]int{"duration": 500})))
+}
+
+func TestParseEvents(t *testing.T) {
+	got := parseEvents([]byte(`[
+		{"type":"update","data":[
+			{"id":"b1","type":"button","button":{"button_report":{"event":"short_release"},"last_event":"initial_press"}},
+			{"id":"b2","type":"button","button":{"last_event":"long_press"}},
+			{"id":"m1","type":"motion","motion":{"motion":true}},
+			{"id":"m2","type":"motion","motion":{"motion":true,"motion_report":{"motion":false}}},
+			{"id":"l1","type":"light","on":{"on":true}}
+		]},
+		{"type":"add","data":[{"id":"b3","type":"button","button":{"last_event":"repeat"}}]}
+	]`))
+	want := []Event{
+		{Resource: "b1", Type: "button", Event: "short_release"},
+		{Resource: "b2", Type: "button", Event: "long_press"},
+		{Resource: "m1", Type: "motion", Event: "motion"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("parseEvents = %+v, want %+v", got, want)
+	}
+	if got := parseEvents([]byte(`not json`)); got != nil {
+		t.Errorf("parseEvents(garbage) = %+v", got)
+	}
+}
+
+func TestWatchReconnects(t *testing.T) {
+	defer func(d time.Duration) { watchBackoff = d }(watchBackoff)
+	watchBackoff = 10 * time.Millisecond
+
+	var mutex sync.Mutex
+	connections := 0
+	keys := make(map[string]bool)
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/eventstream/clip/v2" {
+			http.NotFound(w, r)
+			return
+		}
+		mutex.Lock()
+		connections++
+		n := connections
+		keys[r.Header.Get("hue-application-key")] = true
+		mutex.Unlock()
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		// an event split over two data lines, then the stream drops
+		fmt.Fprintf(w, ": hi\n\nid: %d:0\ndata: [{\"type\":\"update\",\"data\":\n", n)
+		fmt.Fprintf(w, "data: [{\"id\":\"button\",\"type\":\"button\",\"button\":{\"button_report\":{\"event\":\"short_release\"}}}]}]\n\n")
+		fmt.Fprintf(w, "data: [{\"type\":\"update\",\"data\":[{\"id\":\"other\",\"type\":\"button\",\"button\":{\"last_event\":\"short_release\"}}]}]\n\n")
+	}))
+	defer srv.Close()
+
+	c := v2Parse(t, srv, `device_id = "lamp"
+
+[[trigger]]
+resource = "button"
+event = "short_release"
+message = "COFFEE"
+`)
+	fired := make(chan Trigger, 10)
+	go c.Watch(func(tr Trigger) { fired <- tr })
+
+	for i := 0; i < 2; i++ {
+		select {
+		case tr := <-fired:
+			if tr.Message != "COFFEE" {
+				t.Errorf("fired %+v", tr)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("trigger %d not fired", i+1)
+		}
+	}
+	mutex.Lock()
+	defer mutex.Unlock()
+	if connections < 2 {
+		t.Errorf("%d connections, want a reconnect", connections)
+	}
+	if len(keys) != 1 || !keys["key"] {
+		t.Errorf("hue-application-key headers = %v", keys)
+	}
+}
+
+func TestV2Verify(t *testing.T) {
+	b := newFakeBridge(true)
+	defer b.Close()
+	b.setState("/clip/v2/resource/light/lamp", `{"data":[{"on":{"on":true}}]}`)
+
+	c := v2Config(t, b, `device_id = "lamp"`)
+	if _, err := c.v2GetState("light/lamp"); err != nil {
+		t.Fatalf("trusted bridge: %v", err)
+	}
+	b.take()
+
+	// another bridge ID, or the Signify root, which did not sign the test
+	// certificate
+	ca := writeCA(t, b.Server)
+	defer os.Remove(ca)
+	c.BridgeID, c.BridgeCA = "001788fffe000000", ca
+	if err := c.v2Setup(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.v2GetState("light/lamp"); err == nil {
+		t.Error("bridge accepted under another ID")
+	}
+	c.BridgeID, c.BridgeCA = "example.com", ""
+	if err := c.v2Setup(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.v2GetState("light/lamp"); err == nil {
+		t.Error("bridge accepted without its CA")
+	}
+	if r := b.take(); len(r) != 0 {
+		t.Errorf("untrusted connections sent %v", r)
+	}
+}
+
+func TestV2ValidateTLS(t *testing.T) {
+	for _, text := range []string{
+		"", // no bridge_id
+		"bridge_id = \"x\"\nbridge_ca = \"/nonexistent\"",       // unreadable CA
+		"bridge_id = \"x\"\nbridge_ca = \"" + os.DevNull + "\"", // no certificates
+	} {
+		var c Config
+		if _, err := toml.Decode("bridge_ip = \"b\"\napi_key = \"k\"\ndevice_id = \"1\"\napi_version = 2\n"+text, &c); err != nil {
+			t.Fatal(err)
+		}
+		if err := c.validate(); err == nil {
+			t.Errorf("validate accepted %q", text)
+		}
+	}
+}
+
+// TestVerifyBridge checks a chain like a bridge's: a leaf signed by the
+// root, naming the bridge ID in its Common Name only.
+func TestVerifyBridge(t *testing.T) {
+	root, rootKey := testCert(t, "root-bridge", nil, nil)
+	leaf, _ := testCert(t, "001788fffe123456", root, rootKey)
+	other, _ := testCert(t, "other-root", nil, nil)
+
+	roots := x509.NewCertPool()
+	roots.AddCert(root)
+	for _, test := range []struct {
+		id    string
+		chain []*x509.Certificate
+		ok    bool
+	}{
+		{"001788fffe123456", []*x509.Certificate{leaf}, true},
+		{"001788FFFE123456", []*x509.Certificate{leaf}, true},
+		{"001788fffe123457", []*x509.Certificate{leaf}, false},
+		{"other-root", []*x509.Certificate{other}, false},
+		{"001788fffe123456", nil, false},
+	} {
+		raw := make([][]byte, len(test.chain))
+		for i, cert := range test.chain {
+			raw[i] = cert.Raw
+		}
+		if err := verifyBridge(roots, test.id)(raw, nil); (err == nil) != test.ok {
+			t.Errorf("verify %s: %v, want ok %v", test.id, err, test.ok)
+		}
+	}
+
+	// the built-in root parses
+	if !x509.NewCertPool().AppendCertsFromPEM([]byte(signifyRoot)) {
+		t.Error("signifyRoot holds no certificate")
+	}
+}
+
+// testCert makes a certificate for cn, signed by parent (self-signed when
+// nil).
+func testCert(t *testing.T, cn string, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (*x509.Certificate, *ecdsa.PrivateKey) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: cn},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	if parent == nil {
+		tmpl.IsCA, tmpl.BasicConstraintsValid = true, true
+		tmpl.KeyUsage = x509.KeyUsageCertSign
+		parent, parentKey = tmpl, key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert, key
+}
+
+func TestV2IdleRestoreEveryTarget(t *testing.T) {
+	b := newFakeBridge(true)
+	defer b.Close()
+	b.setState("/clip/v2/resource/light/lamp", `{"data":[{"on":{"on":false}}]}`)
+	b.setState("/clip/v2/resource/grouped_light/room", `{"data":[{"on":{"on":true},"dimming":{"brightness":20},
+		"color_temperature":{"mirek":300,"mirek_valid":true}}]}`)
+	c := v2Config(t, b, `device_id = "lamp"
+
+[[message]]
+match = "alert"
+group = "room"
+on = true
+
+[on_idle]
+mode = "restore"
+`)
+
+	c.MessageShown("ALERT")
+	c.MessageShown("hello")
+	c.MessageShown("alert")
+	checkRequests(t, b.take(),
+		get("/clip/v2/resource/grouped_light/room"),
+		put("/clip/v2/resource/grouped_light/room", body("on", map[string]bool{"on": true})),
+		get("/clip/v2/resource/light/lamp"),
+		put("/clip/v2/resource/light/lamp", body("on", map[string]bool{"on": true})),
+		put("/clip/v2/resource/grouped_light/room", body("on", map[string]bool{"on": true})))
+
+	c.Idle()
+	checkRequests(t, b.take(),
+		put("/clip/v2/resource/grouped_light/room", body(
+			"on", map[string]bool{"on": true},
+			"dimming", map[string]float64{"brightness": 20},
+			"color_temperature", map[string]int{"mirek": 300})),
+		put("/clip/v2/resource/light/lamp", body("on", map[string]bool{"on": false})))
+
+	c.Idle()
+	checkRequests(t, b.take())
+}
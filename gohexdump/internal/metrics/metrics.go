@@ -0,0 +1,267 @@
+// Package metrics is a minimal Prometheus-compatible metrics registry.
+// It supports counters (optionally with one label), gauges and histograms,
+// and serves them in the Prometheus text exposition format. Metrics are
+// created at package level by the code that records them and register
+// themselves with the default registry served by Handler.
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+type metric interface {
+	name() string
+	write(w io.Writer)
+}
+
+var (
+	registryMutex sync.Mutex
+	registry      []metric
+)
+
+func register(m metric) {
+	registryMutex.Lock()
+	defer registryMutex.Unlock()
+	for _, r := range registry {
+		if r.name() == m.name() {
+			panic("metrics: duplicate metric " + m.name())
+		}
+	}
+	registry = append(registry, m)
+}
+
+func header(w io.Writer, name, help, typ string) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, typ)
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+func escapeLabel(v string) string {
+	v = strings.Replace(v, `\`, `\\`, -1)
+	v = strings.Replace(v, `"`, `\"`, -1)
+	return strings.Replace(v, "\n", `\n`, -1)
+}
+
+// Counter is a monotonically increasing count.
+type Counter struct {
+	v uint64
+}
+
+// Inc adds one.
+func (c *Counter) Inc() {
+	atomic.AddUint64(&c.v, 1)
+}
+
+// Add adds n.
+func (c *Counter) Add(n uint64) {
+	atomic.AddUint64(&c.v, n)
+}
+
+// Value returns the current count.
+func (c *Counter) Value() uint64 {
+	return atomic.LoadUint64(&c.v)
+}
+
+type counter struct {
+	Counter
+	n, help string
+}
+
+// NewCounter registers and returns a counter.
+func NewCounter(name, help string) *Counter {
+	c := &counter{n: name, help: help}
+	register(c)
+	return &c.Counter
+}
+
+func (c *counter) name() string { return c.n }
+
+func (c *counter) write(w io.Writer) {
+	header(w, c.n, c.help, "counter")
+	fmt.Fprintf(w, "%s %d\n", c.n, c.Value())
+}
+
+// CounterVec is a family of counters distinguished by one label.
+type CounterVec struct {
+	n, help, label string
+	mutex          sync.Mutex
+	counters       map[string]*Counter
+}
+
+// NewCounterVec registers and returns a counter family. Label values are
+// created on first use; pass the expected ones in preset so they report 0
+// before anything happens.
+func NewCounterVec(name, help, label string, preset ...string) *CounterVec {
+	v := &CounterVec{n: name, help: help, label: label, counters: map[string]*Counter{}}
+	for _, p := range preset {
+		v.With(p)
+	}
+	register(v)
+	return v
+}
+
+// With returns the counter for a label value.
+func (v *CounterVec) With(value string) *Counter {
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+	c, ok := v.counters[value]
+	if !ok {
+		c = new(Counter)
+		v.counters[value] = c
+	}
+	return c
+}
+
+func (v *CounterVec) name() string { return v.n }
+
+func (v *CounterVec) write(w io.Writer) {
+	v.mutex.Lock()
+	values := make([]string, 0, len(v.counters))
+	for k := range v.counters {
+		values = append(values, k)
+	}
+	v.mutex.Unlock()
+	sort.Strings(values)
+
+	header(w, v.n, v.help, "counter")
+	for _, k := range values {
+		fmt.Fprintf(w, "%s{%s=\"%s\"} %d\n", v.n, v.label, escapeLabel(k), v.With(k).Value())
+	}
+}
+
+// Gauge is a value that can go up and down.
+type Gauge struct {
+	bits uint64
+	n    string
+	help string
+	fn   func() float64
+}
+
+// NewGauge registers and returns a gauge.
+func NewGauge(name, help string) *Gauge {
+	g := &Gauge{n: name, help: help}
+	register(g)
+	return g
+}
+
+// NewGaugeFunc registers a gauge whose value is read from fn at scrape time.
+func NewGaugeFunc(name, help string, fn func() float64) {
+	register(&Gauge{n: name, help: help, fn: fn})
+}
+
+// Set sets the gauge value.
+func (g *Gauge) Set(v float64) {
+	atomic.StoreUint64(&g.bits, math.Float64bits(v))
+}
+
+// Value returns the current gauge value.
+func (g *Gauge) Value() float64 {
+	if g.fn != nil {
+		return g.fn()
+	}
+	return math.Float64frombits(atomic.LoadUint64(&g.bits))
+}
+
+func (g *Gauge) name() string { return g.n }
+
+func (g *Gauge) write(w io.Writer) {
+	header(w, g.n, g.help, "gauge")
+	fmt.Fprintf(w, "%s %s\n", g.n, formatFloat(g.Value()))
+}
+
+// Histogram counts observations into cumulative buckets.
+type Histogram struct {
+	n, help string
+	bounds  []float64 // upper bounds, ascending, without +Inf
+	mutex   sync.Mutex
+	counts  []uint64 // per bucket, not cumulative; last is +Inf
+	sum     float64
+	count   uint64
+}
+
+// NewHistogram registers and returns a histogram with the given bucket
+// upper bounds (ascending).
+func NewHistogram(name, help string, buckets []float64) *Histogram {
+	h := &Histogram{
+		n:      name,
+		help:   help,
+		bounds: buckets,
+		counts: make([]uint64, len(buckets)+1),
+	}
+	register(h)
+	return h
+}
+
+// ExponentialBuckets returns count bounds starting at start, each factor
+// times the previous.
+func ExponentialBuckets(start, factor float64, count int) []float64 {
+	b := make([]float64, count)
+	for i := range b {
+		b[i] = start
+		start *= factor
+	}
+	return b
+}
+
+// Observe records one value.
+func (h *Histogram) Observe(v float64) {
+	i := sort.SearchFloat64s(h.bounds, v)
+	h.mutex.Lock()
+	h.counts[i]++
+	h.sum += v
+	h.count++
+	h.mutex.Unlock()
+}
+
+func (h *Histogram) name() string { return h.n }
+
+func (h *Histogram) write(w io.Writer) {
+	h.mutex.Lock()
+	counts := append([]uint64(nil), h.counts...)
+	sum, count := h.sum, h.count
+	h.mutex.Unlock()
+
+	header(w, h.n, h.help, "histogram")
+	var cumulative uint64
+	for i, b := range h.bounds {
+		cumulative += counts[i]
+		fmt.Fprintf(w, "%s_bucket{le=\"%s\"} %d\n", h.n, formatFloat(b), cumulative)
+	}
+	fmt.Fprintf(w, "%s_bucket{le=\"+Inf\"} %d\n", h.n, count)
+	fmt.Fprintf(w, "%s_sum %s\n", h.n, formatFloat(sum))
+	fmt.Fprintf(w, "%s_count %d\n", h.n, count)
+}
+
+// WriteText writes all registered metrics in the Prometheus text format.
+func WriteText(w io.Writer) {
+	registryMutex.Lock()
+	metrics := append([]metric(nil), registry...)
+	registryMutex.Unlock()
+	for _, m := range metrics {
+		m.write(w)
+	}
+}
+
+// Handler serves the registered metrics for Prometheus to scrape.
+func Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		WriteText(w)
+	})
+}
@@ -0,0 +1,256 @@
+// Package playlist rotates the board's idle screens. The playlist is TOML,
+// kept at /var/lib/hexboard/playlist.toml: a list of entries, each naming a
+// screen (rain, clock, plasma, recent messages, a video file) with a dwell
+// time and an optional time-of-day window. The Rotator is the idle Screen;
+// it shows each entry whose window contains the current time in turn.
+package playlist
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/BurntSushi/toml"
+
+	"post6.net/gohexdump/internal/screen"
+)
+
+// ConfigPath is where the playlist is read from and saved to.
+const ConfigPath = "/var/lib/hexboard/playlist.toml"
+
+// Screen names understood by hexboard.
+const (
+	Rain      = "rain"
+	Clock     = "clock"
+	RainClock = "rain+clock"
+	Plasma    = "plasma"
+	Recent    = "recent"
+	Video     = "video"
+)
+
+// Screens lists the valid Entry.Screen values.
+var Screens = []string{Rain, Clock, RainClock, Plasma, Recent, Video}
+
+// DefaultDwell is used for entries without a dwell time.
+const DefaultDwell = 5 * time.Minute
+
+// Playlist is the contents of playlist.toml.
+type Playlist struct {
+	Entries []Entry `toml:"entry"`
+}
+
+// Entry is one idle screen in the rotation.
+type Entry struct {
+	Screen string `toml:"screen"`
+
+	// Dwell is how long the entry is shown, e.g. "2m" (default 5m).
+	Dwell string `toml:"dwell"`
+
+	// From and Until restrict the entry to a time of day, "HH:MM" local
+	// time. The window may wrap midnight ("22:00" to "07:00"); either
+	// may be empty for an open end.
+	From  string `toml:"from"`
+	Until string `toml:"until"`
+
+	// Brightness scales the screen, 0 to 1 (default 1).
+	Brightness float64 `toml:"brightness"`
+
+	// File and FPS are for video entries, as written by encvid. FPS
+	// overrides the rate in the file; headerless raw video defaults to 30.
+	File string `toml:"file"`
+	FPS  int    `toml:"fps"`
+
+	dwell       time.Duration
+	from, until int // minutes since midnight, -1 if unset
+}
+
+// Parse decodes and validates a playlist in TOML.
+func Parse(text string) (*Playlist, error) {
+	var p Playlist
+	if _, err := toml.Decode(text, &p); err != nil {
+		return nil, err
+	}
+	if err := p.validate(); err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+// Save writes playlist text to path, replacing the file atomically. The
+// text is stored as given, comments included; Parse it first.
+func Save(path, text string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := ioutil.WriteFile(tmp, []byte(text), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+func (p *Playlist) validate() error {
+	if len(p.Entries) == 0 {
+		return fmt.Errorf("no entries")
+	}
+	for i := range p.Entries {
+		if err := p.Entries[i].validate(); err != nil {
+			return fmt.Errorf("entry %d: %v", i+1, err)
+		}
+	}
+	return nil
+}
+
+func (e *Entry) validate() error {
+	e.Screen = strings.ToLower(strings.TrimSpace(e.Screen))
+	known := false
+	for _, s := range Screens {
+		known = known || e.Screen == s
+	}
+	if !known {
+		return fmt.Errorf("unknown screen %q (want one of %s)", e.Screen, strings.Join(Screens, ", "))
+	}
+	if e.Screen == Video && e.File == "" {
+		return fmt.Errorf("video needs a file")
+	}
+
+	e.dwell = DefaultDwell
+	if e.Dwell != "" {
+		d, err := time.ParseDuration(e.Dwell)
+		if err != nil || d <= 0 {
+			return fmt.Errorf("bad dwell %q", e.Dwell)
+		}
+		e.dwell = d
+	}
+
+	var err error
+	if e.from, err = parseClock(e.From); err != nil {
+		return fmt.Errorf("from: %v", err)
+	}
+	if e.until, err = parseClock(e.Until); err != nil {
+		return fmt.Errorf("until: %v", err)
+	}
+
+	if e.Brightness < 0 || e.Brightness > 1 {
+		return fmt.Errorf("brightness must be between 0 and 1")
+	}
+	if e.FPS < 0 {
+		return fmt.Errorf("fps must be positive")
+	}
+	return nil
+}
+
+func parseClock(s string) (int, error) {
+	if s == "" {
+		return -1, nil
+	}
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, fmt.Errorf("want HH:MM, got %q", s)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// Active reports whether t falls in the entry's time-of-day window.
+func (e *Entry) Active(t time.Time) bool {
+	if e.from == -1 && e.until == -1 {
+		return true
+	}
+	m := t.Hour()*60 + t.Minute()
+	from, until := e.from, e.until
+	if from == -1 {
+		from = 0
+	}
+	if until == -1 {
+		until = 24 * 60
+	}
+	if from <= until {
+		return from <= m && m < until
+	}
+	return m >= from || m < until // wraps midnight
+}
+
+// DwellTime returns how long the entry is shown.
+func (e *Entry) DwellTime() time.Duration {
+	return e.dwell
+}
+
+// Rotator is an idle Screen that shows the playlist entries in turn,
+// skipping entries outside their time window. When no entry is active it
+// shows the fallback.
+type Rotator struct {
+	mutex    sync.Mutex
+	playlist *Playlist
+	screens  []screen.Screen
+	fallback screen.Screen
+	current  int // -1 while showing the fallback
+	until    time.Time
+
+	now func() time.Time
+}
+
+// NewRotator returns a Rotator over p, whose entries are shown as screens
+// (one per entry, in order).
+func NewRotator(p *Playlist, screens []screen.Screen, fallback screen.Screen) *Rotator {
+	return &Rotator{
+		playlist: p,
+		screens:  screens,
+		fallback: fallback,
+		current:  -1,
+		now:      time.Now,
+	}
+}
+
+// Set replaces the playlist; the first active entry is shown next. Set
+// waits for a frame being drawn, so once it returns the old screens are no
+// longer used and may be closed.
+func (r *Rotator) Set(p *Playlist, screens []screen.Screen) {
+	r.mutex.Lock()
+	r.playlist, r.screens = p, screens
+	r.current, r.until = -1, time.Time{}
+	r.mutex.Unlock()
+}
+
+// restarter is implemented by screens that play from the start each time
+// they come up, such as screen.VideoScreen.
+type restarter interface {
+	Restart()
+}
+
+// next moves to the first active entry after the current one. Must be
+// called with r.mutex held.
+func (r *Rotator) next(now time.Time) {
+	n := len(r.playlist.Entries)
+	for i := 1; i <= n; i++ {
+		j := (r.current + i) % n
+		if r.playlist.Entries[j].Active(now) {
+			r.current = j
+			r.until = now.Add(r.playlist.Entries[j].dwell)
+			if s, ok := r.screens[j].(restarter); ok {
+				s.Restart()
+			}
+			return
+		}
+	}
+	r.current = -1
+	r.until = now.Add(time.Minute) // look again in a minute
+}
+
+func (r *Rotator) NextFrame(f, old *screen.FrameBuffer, tick uint64) bool {
+	r.mutex.Lock()
+	now := r.now()
+	if !now.Before(r.until) || r.current != -1 && !r.playlist.Entries[r.current].Active(now) {
+		r.next(now)
+	}
+	s := r.fallback
+	if r.current != -1 {
+		s = r.screens[r.current]
+	}
+	// held while drawing, so that Set cannot return mid-frame
+	defer r.mutex.Unlock()
+	return s.NextFrame(f, old, tick)
+}
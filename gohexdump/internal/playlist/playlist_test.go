@@ -0,0 +1,199 @@
+package playlist
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"post6.net/gohexdump/internal/screen"
+)
+
+func TestParse(t *testing.T) {
+	p, err := Parse(`
+[[entry]]
+screen = " Rain "
+
+[[entry]]
+screen = "video"
+file   = "/tmp/a.seg"
+dwell  = "90s"
+from   = "22:00"
+until  = "07:00"
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(p.Entries) != 2 {
+		t.Fatalf("%d entries, want 2", len(p.Entries))
+	}
+	if e := p.Entries[0]; e.Screen != Rain || e.DwellTime() != DefaultDwell || e.from != -1 || e.until != -1 {
+		t.Errorf("entry 1 = %+v", e)
+	}
+	if e := p.Entries[1]; e.DwellTime() != 90*time.Second || e.from != 22*60 || e.until != 7*60 {
+		t.Errorf("entry 2 = %+v", e)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, test := range []struct {
+		text, err string
+	}{
+		{``, "no entries"},
+		{`[[entry]]
+screen = "disco"`, `entry 1: unknown screen "disco"`},
+		{`[[entry]]
+screen = "rain"
+[[entry]]
+screen = "video"`, "entry 2: video needs a file"},
+		{`[[entry]]
+screen = "rain"
+dwell = "soon"`, `bad dwell "soon"`},
+		{`[[entry]]
+screen = "rain"
+dwell = "-5m"`, `bad dwell "-5m"`},
+		{`[[entry]]
+screen = "rain"
+dwell = "0s"`, `bad dwell "0s"`},
+		{`[[entry]]
+screen = "clock"
+from = "25:00"`, "from: want HH:MM"},
+		{`[[entry]]
+screen = "clock"
+until = "noon"`, "until: want HH:MM"},
+		{`[[entry]]
+screen = "plasma"
+brightness = 1.5`, "brightness"},
+		{`[[entry]]
+screen = "video"
+file = "a.seg"
+fps = -1`, "fps"},
+		{`[[entry]
+screen = "rain"`, ""}, // bad TOML
+	} {
+		_, err := Parse(test.text)
+		if err == nil {
+			t.Errorf("Parse(%q) succeeded", test.text)
+		} else if !strings.Contains(err.Error(), test.err) {
+			t.Errorf("Parse(%q) = %v, want %q", test.text, err, test.err)
+		}
+	}
+}
+
+func at(hhmm string) time.Time {
+	t, err := time.Parse("15:04", hhmm)
+	if err != nil {
+		panic(err)
+	}
+	return time.Date(2024, 3, 1, t.Hour(), t.Minute(), 30, 0, time.Local)
+}
+
+func TestActive(t *testing.T) {
+	for _, test := range []struct {
+		from, until string
+		active      []string
+		inactive    []string
+	}{
+		{"", "", []string{"00:00", "12:00", "23:59"}, nil},
+		{"09:00", "17:00", []string{"09:00", "12:00", "16:59"}, []string{"08:59", "17:00", "23:00"}},
+		{"22:00", "07:00", []string{"22:00", "23:59", "00:00", "06:59"}, []string{"07:00", "12:00", "21:59"}},
+		{"22:00", "", []string{"22:00", "23:59"}, []string{"00:00", "21:59"}},
+		{"", "07:00", []string{"00:00", "06:59"}, []string{"07:00", "23:59"}},
+		{"08:00", "08:00", nil, []string{"07:59", "08:00", "08:01"}},
+	} {
+		e := Entry{Screen: Clock, From: test.from, Until: test.until}
+		if err := e.validate(); err != nil {
+			t.Fatal(err)
+		}
+		for _, hhmm := range test.active {
+			if !e.Active(at(hhmm)) {
+				t.Errorf("%q to %q: inactive at %s", test.from, test.until, hhmm)
+			}
+		}
+		for _, hhmm := range test.inactive {
+			if e.Active(at(hhmm)) {
+				t.Errorf("%q to %q: active at %s", test.from, test.until, hhmm)
+			}
+		}
+	}
+}
+
+// namedScreen records its name in shown each time it draws a frame.
+type namedScreen struct {
+	name     string
+	shown    *[]string
+	restarts int
+}
+
+func (s *namedScreen) NextFrame(f, old *screen.FrameBuffer, tick uint64) bool {
+	*s.shown = append(*s.shown, s.name)
+	return true
+}
+
+func (s *namedScreen) Restart() { s.restarts++ }
+
+func TestRotator(t *testing.T) {
+	p, err := Parse(`
+[[entry]]
+screen = "rain"
+dwell = "1m"
+
+[[entry]]
+screen = "clock"
+dwell = "1m"
+from = "09:00"
+until = "17:00"
+
+[[entry]]
+screen = "video"
+file = "a.seg"
+dwell = "2m"
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var shown []string
+	rain := &namedScreen{name: "rain", shown: &shown}
+	clock := &namedScreen{name: "clock", shown: &shown}
+	video := &namedScreen{name: "video", shown: &shown}
+	fallback := &namedScreen{name: "fallback", shown: &shown}
+	r := NewRotator(p, []screen.Screen{rain, clock, video}, fallback)
+
+	now := at("08:00")
+	r.now = func() time.Time { return now }
+	frame := func(advance time.Duration) {
+		now = now.Add(advance)
+		r.NextFrame(nil, nil, 0)
+	}
+
+	// before 09:00 the clock is skipped
+	frame(0)
+	frame(30 * time.Second)
+	frame(30 * time.Second)
+	frame(time.Minute)
+	frame(time.Minute)
+	// from 09:00 it comes up in turn
+	now = at("09:00")
+	frame(0)
+	frame(time.Minute)
+	frame(time.Minute)
+
+	want := []string{"rain", "rain", "video", "video", "rain", "clock", "video", "video"}
+	if strings.Join(shown, " ") != strings.Join(want, " ") {
+		t.Errorf("shown %q, want %q", shown, want)
+	}
+	if video.restarts != 2 {
+		t.Errorf("video restarted %d times, want each time it came up (2)", video.restarts)
+	}
+
+	// an entry leaving its window is left at once
+	shown = nil
+	now = at("16:58")
+	r.Set(p, []screen.Screen{rain, clock, video})
+	frame(0)
+	frame(time.Minute)      // 16:59:30, the clock until 17:00:30
+	frame(40 * time.Second) // 17:00:10
+	want = []string{"rain", "clock", "video"}
+	if strings.Join(shown, " ") != strings.Join(want, " ") {
+		t.Errorf("shown %q, want %q", shown, want)
+	}
+}
@@ -0,0 +1,121 @@
+package screen
+
+import (
+	"math"
+
+	"post6.net/gohexdump/internal/font"
+)
+
+const (
+	glyphSegments = 1<<14 - 1 // the 14 segments, without Dp and the unused slot
+	outerSegments = 1<<6 - 1  // A to F
+)
+
+// BackgroundStyle lights the glyph at fg and the rest of the 14 segments
+// at bg: with fg 0 it is inverse video, with a low bg a ghost of every
+// segment behind the text.
+type BackgroundStyle struct {
+	fg, bg float64
+}
+
+func NewBackground(fg, bg float64) Style {
+	return &BackgroundStyle{fg: math.Max(0, math.Min(1, fg)), bg: math.Max(0, math.Min(1, bg))}
+}
+
+// NewInverse returns inverse video: a lit background, dark glyph.
+func NewInverse(brightness float64) Style {
+	return NewBackground(0, brightness)
+}
+
+// NewGhost shows the glyph at brightness over all segments dimly lit.
+func NewGhost(brightness, ghost float64) Style {
+	return NewBackground(brightness, ghost)
+}
+
+func (s *BackgroundStyle) Apply() Style {
+	return s
+}
+
+func (s *BackgroundStyle) Render(dst []float64, glyph font.Glyph, frameIndex int, tick uint64) {
+	for i := range dst {
+		bit := font.Glyph(1) << uint(i)
+		switch {
+		case glyph&bit != 0:
+			dst[i] = s.fg
+		case glyphSegments&bit != 0:
+			dst[i] = s.bg
+		default:
+			dst[i] = 0
+		}
+	}
+}
+
+// OutlineStyle draws the outer segments of a glyph (A to F) at fg and its
+// inner strokes at inner, so that letters read as outlines.
+type OutlineStyle struct {
+	fg, inner float64
+}
+
+func NewOutline(brightness, inner float64) Style {
+	return &OutlineStyle{fg: math.Max(0, math.Min(1, brightness)), inner: math.Max(0, math.Min(1, inner))}
+}
+
+func (s *OutlineStyle) Apply() Style {
+	return s
+}
+
+func (s *OutlineStyle) Render(dst []float64, glyph font.Glyph, frameIndex int, tick uint64) {
+	for i := range dst {
+		bit := font.Glyph(1) << uint(i)
+		switch {
+		case glyph&bit == 0:
+			dst[i] = 0
+		case outerSegments&bit != 0:
+			dst[i] = s.fg
+		default:
+			dst[i] = s.inner
+		}
+	}
+}
+
+// GradientStyle lights each glyph segment by its position on the screen,
+// from one brightness to another along a direction.
+type GradientStyle struct {
+	levels []float64 // per segment
+}
+
+// NewGradient fades from brightness from to brightness to across info,
+// along angle in degrees: 0 runs left to right, 90 top to bottom.
+func NewGradient(info ScreenInfo, from, to, angle float64) Style {
+	dir := Vector2{math.Cos(angle * math.Pi / 180), math.Sin(angle * math.Pi / 180)}
+	coords := info.Coords()
+	levels := make([]float64, len(coords))
+	min, max := math.Inf(1), math.Inf(-1)
+	for i, c := range coords {
+		levels[i] = c.X*dir.X + c.Y*dir.Y
+		min, max = math.Min(min, levels[i]), math.Max(max, levels[i])
+	}
+	for i, p := range levels {
+		t := 0.
+		if max > min {
+			t = (p - min) / (max - min)
+		}
+		levels[i] = math.Max(0, math.Min(1, from+t*(to-from)))
+	}
+	return &GradientStyle{levels: levels}
+}
+
+func (s *GradientStyle) Apply() Style {
+	return s
+}
+
+func (s *GradientStyle) Render(dst []float64, glyph font.Glyph, frameIndex int, tick uint64) {
+	base := frameIndex * 16
+	for i := range dst {
+		if glyph&(1<<uint(i)) != 0 && base+i < len(s.levels) {
+			dst[i] = s.levels[base+i]
+		} else {
+			dst[i] = 0
+		}
+	}
+}
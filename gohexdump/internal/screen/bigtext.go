@@ -0,0 +1,155 @@
+package screen
+
+import (
+	"math"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+const (
+	bigRows        = 7   // rows in bigFont
+	bigScrollSpeed = 10. // font pixels per second for text too wide to fit
+	bigGap         = 8   // font pixels between the end of scrolling text and its start
+)
+
+// bigSamples are where each segment samples the font, in font pixels
+// around its position, so that segments on the edge of a stroke are partly
+// lit.
+var bigSamples = []Vector2{{-.25, -.25}, {.25, -.25}, {-.25, .25}, {.25, .25}}
+
+// BigText renders text in a bitmap font as tall as the screen, sampling
+// each segment at its position: every digit becomes a pixel, lit or partly
+// lit. Text that does not fit scrolls. It is a Screen, and a Filter for
+// layering it over another screen.
+type BigText struct {
+	coords     []Vector2
+	min        Vector2
+	pixel      float64 // size of a font pixel
+	columns    float64 // screen width in font pixels
+	brightness float64
+
+	mutex  sync.Mutex
+	bitmap [bigRows][]bool
+	start  uint64
+	begun  bool
+}
+
+func NewBigText(info ScreenInfo, brightness float64) *BigText {
+	coords := info.Coords()
+	min := Vector2{math.Inf(1), math.Inf(1)}
+	max := Vector2{math.Inf(-1), math.Inf(-1)}
+	for i, c := range coords {
+		if i%16 >= 14 {
+			continue // Dp and the unused slot
+		}
+		min.X, min.Y = math.Min(min.X, c.X), math.Min(min.Y, c.Y)
+		max.X, max.Y = math.Max(max.X, c.X), math.Max(max.Y, c.Y)
+	}
+	pixel := (max.Y - min.Y) / bigRows
+	return &BigText{
+		coords:     coords,
+		min:        min,
+		pixel:      pixel,
+		columns:    (max.X - min.X) / pixel,
+		brightness: math.Max(0, math.Min(1, brightness)),
+	}
+}
+
+// SetText sets the text shown, uppercased; characters missing from the
+// font show as '?'. Letters and digits are five pixels wide, so that
+// countdowns do not jitter; punctuation is narrower.
+func (b *BigText) SetText(text string) {
+	var bitmap [bigRows][]bool
+	for i, r := range []rune(strings.ToUpper(text)) {
+		rows, ok := bigFont[r]
+		if !ok {
+			r, rows = '?', bigFont['?']
+		}
+		lo, hi := 0, 5
+		switch {
+		case r == ' ':
+			hi = 3
+		case !unicode.IsLetter(r) && !unicode.IsDigit(r):
+			lo, hi = bigTrim(rows)
+		}
+		if i > 0 {
+			for y := range bitmap {
+				bitmap[y] = append(bitmap[y], false)
+			}
+		}
+		for x := lo; x < hi; x++ {
+			for y := range bitmap {
+				bitmap[y] = append(bitmap[y], rows[y]&(0x10>>uint(x)) != 0)
+			}
+		}
+	}
+
+	b.mutex.Lock()
+	b.bitmap, b.begun = bitmap, false
+	b.mutex.Unlock()
+}
+
+// bigTrim returns the range of columns a glyph uses.
+func bigTrim(rows [bigRows]byte) (int, int) {
+	var used byte
+	for _, r := range rows {
+		used |= r
+	}
+	lo, hi := 0, 5
+	for lo < hi && used&(0x10>>uint(lo)) == 0 {
+		lo++
+	}
+	for hi > lo && used&(0x10>>uint(hi-1)) == 0 {
+		hi--
+	}
+	return lo, hi
+}
+
+// levels calls set with the level of every segment at tick.
+func (b *BigText) levels(tick uint64, set func(i int, v float64)) {
+	b.mutex.Lock()
+	if !b.begun {
+		b.begun, b.start = true, tick
+	}
+	bitmap, start := b.bitmap, b.start
+	b.mutex.Unlock()
+
+	width := float64(len(bitmap[0]))
+	period := width + bigGap
+	shift := (width - b.columns) / 2 // centred
+	scroll := width > b.columns
+	if scroll {
+		shift = float64(tick-start) / Fps * bigScrollSpeed
+	}
+
+	for i, c := range b.coords {
+		if i%16 >= 14 {
+			continue
+		}
+		x := (c.X-b.min.X)/b.pixel + shift
+		y := (c.Y - b.min.Y) / b.pixel
+		lit := 0
+		for _, s := range bigSamples {
+			sx, sy := x+s.X, math.Max(0, math.Min(bigRows-1e-9, y+s.Y))
+			if scroll {
+				sx = math.Mod(sx, period)
+			}
+			col := int(math.Floor(sx))
+			if sx >= 0 && col < len(bitmap[0]) && bitmap[int(sy)][col] {
+				lit++
+			}
+		}
+		set(i, b.brightness*float64(lit)/float64(len(bigSamples)))
+	}
+}
+
+func (b *BigText) NextFrame(f, old *FrameBuffer, tick uint64) bool {
+	b.levels(tick, func(i int, v float64) { f.frame[i] = v })
+	return true
+}
+
+// Render draws the text over f, keeping what is brighter underneath.
+func (b *BigText) Render(f *FrameBuffer, old *FrameBuffer, tick uint64) {
+	b.levels(tick, func(i int, v float64) { f.frame[i] = math.Max(f.frame[i], v) })
+}
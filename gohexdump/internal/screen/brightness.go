@@ -0,0 +1,67 @@
+package screen
+
+import (
+	"math"
+	"sync"
+	"time"
+
+	"post6.net/gohexdump/internal/util/clip"
+)
+
+// perceptual levels are turned into output factors with this exponent, so
+// that a fade looks even and .5 looks about half as bright
+const brightnessGamma = 2.5
+
+// BrightnessControl is a Filter scaling the whole output by a level that
+// can change at runtime. Changes fade over the given duration.
+type BrightnessControl struct {
+	mutex         sync.Mutex
+	level, target float64 // perceptual, 0 to 1
+	step          float64 // per frame
+}
+
+func NewBrightnessControl(level float64) *BrightnessControl {
+	level = clip.FloatBetween(level, 0, 1)
+	return &BrightnessControl{level: level, target: level}
+}
+
+// Set fades to level over fade; with fade <= 0 it changes at once.
+func (b *BrightnessControl) Set(level float64, fade time.Duration) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	b.target = clip.FloatBetween(level, 0, 1)
+	frames := fade.Seconds() * Fps
+	if frames < 1 {
+		b.level = b.target
+		return
+	}
+	b.step = math.Abs(b.target-b.level) / frames
+}
+
+// Level returns the current level and the one it is fading to.
+func (b *BrightnessControl) Level() (level, target float64) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.level, b.target
+}
+
+func (b *BrightnessControl) Render(f *FrameBuffer, old *FrameBuffer, tick uint64) {
+
+	b.mutex.Lock()
+	if b.level < b.target {
+		b.level = math.Min(b.level+b.step, b.target)
+	} else if b.level > b.target {
+		b.level = math.Max(b.level-b.step, b.target)
+	}
+	level := b.level
+	b.mutex.Unlock()
+
+	if level == 1 {
+		return
+	}
+	factor := math.Pow(level, brightnessGamma)
+	for i := range f.frame {
+		f.frame[i] *= factor
+	}
+}
@@ -0,0 +1,190 @@
+package screen
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"post6.net/gohexdump/internal/font"
+)
+
+const decimalPoint = font.Glyph(1 << 14)
+
+type ClockZone struct {
+	Label    string
+	Location *time.Location
+}
+
+type ClockOptions struct {
+	Date  bool        // weekday and date next to the time
+	Week  bool        // ISO week number
+	Zones []ClockZone // one row each below the local time
+	Style Style
+}
+
+// Clock draws HH.MM.SS with blinking decimal points as separators. It is a
+// Screen on its own and a Filter when layered over another screen, where it
+// replaces only the digits it writes to. On the minute change it ripples
+// from the minutes, if given a RippleFilter.
+type Clock struct {
+	screen TextScreen
+	ripple *RippleFilter
+	opts   ClockOptions
+
+	mutex  sync.Mutex
+	glyphs []font.Glyph
+	used   []bool
+	blink  []int // digit indices of the separators
+	second int64
+	minute int64
+
+	now func() time.Time
+}
+
+func NewClock(screen TextScreen, ripple *RippleFilter, opts ClockOptions) *Clock {
+	if opts.Style == nil {
+		opts.Style = NewBrightness(.6)
+	}
+	return &Clock{
+		screen: screen,
+		ripple: ripple,
+		opts:   opts,
+		glyphs: make([]font.Glyph, screen.DigitCount()),
+		used:   make([]bool, screen.DigitCount()),
+		second: -1,
+		minute: -1,
+		now:    time.Now,
+	}
+}
+
+// ParseClockZones parses "LABEL=Area/City,..." as used by command line flags.
+func ParseClockZones(s string) ([]ClockZone, error) {
+	var zones []ClockZone
+	for _, field := range strings.Split(s, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		i := strings.Index(field, "=")
+		if i < 0 {
+			return nil, fmt.Errorf("time zone %q: want LABEL=Area/City", field)
+		}
+		loc, err := time.LoadLocation(field[i+1:])
+		if err != nil {
+			return nil, err
+		}
+		zones = append(zones, ClockZone{Label: strings.ToUpper(field[:i]), Location: loc})
+	}
+	return zones, nil
+}
+
+func clockTime(t time.Time, seconds bool) string {
+	if seconds {
+		return fmt.Sprintf("%02d:%02d:%02d", t.Hour(), t.Minute(), t.Second())
+	}
+	return fmt.Sprintf("%02d:%02d", t.Hour(), t.Minute())
+}
+
+func (c *Clock) lines(t time.Time) []string {
+	first := clockTime(t, true)
+	if c.opts.Date {
+		first += "  " + strings.ToUpper(t.Format("Mon 02 Jan 2006"))
+	}
+	if c.opts.Week {
+		_, week := t.ISOWeek()
+		first += fmt.Sprintf("  W%02d", week)
+	}
+	lines := []string{first}
+	for _, z := range c.opts.Zones {
+		zt := t.In(z.Location)
+		line := fmt.Sprintf("%-4s %s", z.Label, clockTime(zt, false))
+		if zt.YearDay() != t.YearDay() {
+			line += " " + strings.ToUpper(zt.Format("Mon"))
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+// write lays out the lines centred on the screen; a ':' becomes a blinking
+// decimal point on the digit before it.
+func (c *Clock) write(lines []string) {
+	columns, rows := c.screen.Size()
+	f := c.screen.Font()
+
+	for i := range c.glyphs {
+		c.glyphs[i], c.used[i] = 0, false
+	}
+	c.blink = c.blink[:0]
+
+	if len(lines) > rows {
+		lines = lines[:rows]
+	}
+	top := (rows - len(lines)) / 2
+	for n, line := range lines {
+		width := len([]rune(strings.Replace(line, ":", "", -1)))
+		col, row := (columns-width)/2, top+n
+		if col < 0 {
+			col = 0
+		}
+		prev := -1
+		for _, r := range line {
+			if r == ':' {
+				if prev != -1 {
+					c.blink = append(c.blink, prev)
+				}
+				continue
+			}
+			ix := c.screen.DigitIndex(col, row)
+			if ix != -1 {
+				c.glyphs[ix] = f.GetGlyph(r)
+				c.used[ix] = true
+			}
+			prev = ix
+			col++
+		}
+	}
+}
+
+func (c *Clock) update() {
+	t := c.now()
+	second := t.Unix()
+	if second == c.second {
+		return
+	}
+	c.second = second
+	c.write(c.lines(t))
+
+	minute := second / 60
+	if c.minute != -1 && minute != c.minute && c.ripple != nil && len(c.blink) > 1 {
+		// the minutes sit between the two separators
+		c.ripple.RippleAt(c.screen.SegmentCoord(c.blink[1]*16 + 3))
+	}
+	c.minute = minute
+}
+
+func (c *Clock) Render(f *FrameBuffer, old *FrameBuffer, tick uint64) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.update()
+	on := c.now().Nanosecond() < 500000000
+	for i, g := range c.glyphs {
+		if !c.used[i] {
+			continue
+		}
+		for _, b := range c.blink {
+			if b == i && on {
+				g |= decimalPoint
+			}
+		}
+		c.opts.Style.Render(f.digits[i], g, i, tick)
+	}
+}
+
+func (c *Clock) NextFrame(f, old *FrameBuffer, tick uint64) bool {
+	f.Clear()
+	c.Render(f, old, tick)
+	return true
+}
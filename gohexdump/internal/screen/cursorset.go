@@ -0,0 +1,146 @@
+package screen
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// cursorLevels are the brightnesses given to client cursors in turn, so
+// that neighbouring cursors can be told apart.
+var cursorLevels = []float64{1, .55, .8, .4}
+
+// maxClientCursors bounds the client cursors; moves by further clients are
+// ignored until one goes away.
+const maxClientCursors = 16
+
+// CursorSet holds a cursor per client, each blinking and rippling on its
+// own, drawn in slot order. SetCursor moves the shared cursor, which is
+// hidden while any client has one.
+type CursorSet struct {
+	newCursor func(brightness float64) Cursor
+
+	mutex   sync.Mutex
+	cursors map[string]*clientCursor
+}
+
+type clientCursor struct {
+	Cursor
+	slot    int
+	expires time.Time // zero: until Expire
+}
+
+// NewCursorSet returns an empty set; newCursor makes each client's cursor,
+// e.g. a RippleCursor on the text screen.
+func NewCursorSet(newCursor func(brightness float64) Cursor) *CursorSet {
+	return &CursorSet{
+		newCursor: newCursor,
+		cursors:   make(map[string]*clientCursor),
+	}
+}
+
+// SetCursor moves the shared cursor.
+func (c *CursorSet) SetCursor(x, y int) {
+	c.SetCursorFor("", x, y, 0)
+}
+
+// SetCursorFor moves the cursor of client id, creating it if needed. With
+// ttl > 0 the cursor goes away unless moved again within ttl; otherwise it
+// stays until Expire. Beyond maxClientCursors, new clients are ignored.
+func (c *CursorSet) SetCursorFor(id string, x, y int, ttl time.Duration) {
+	now := time.Now()
+	c.mutex.Lock()
+	c.expire(now)
+	cur, ok := c.cursors[id]
+	if !ok {
+		slot := 0
+		if id != "" {
+			if c.clients() >= maxClientCursors {
+				c.mutex.Unlock()
+				return
+			}
+			slot = c.freeSlot()
+		}
+		cur = &clientCursor{Cursor: c.newCursor(cursorLevels[slot%len(cursorLevels)]), slot: slot}
+		c.cursors[id] = cur
+	}
+	cur.expires = time.Time{}
+	if ttl > 0 {
+		cur.expires = now.Add(ttl)
+	}
+	c.mutex.Unlock()
+
+	cur.SetCursor(x, y)
+}
+
+// freeSlot returns the lowest slot no client cursor uses.
+// Must be called with c.mutex held.
+func (c *CursorSet) freeSlot() int {
+	for slot := 0; ; slot++ {
+		used := false
+		for id, cur := range c.cursors {
+			if id != "" && cur.slot == slot {
+				used = true
+				break
+			}
+		}
+		if !used {
+			return slot
+		}
+	}
+}
+
+// Expire drops the cursor of client id after d, e.g. once it disconnects,
+// unless it is moved again before then.
+func (c *CursorSet) Expire(id string, d time.Duration) {
+	c.mutex.Lock()
+	if cur, ok := c.cursors[id]; ok {
+		cur.expires = time.Now().Add(d)
+	}
+	c.mutex.Unlock()
+}
+
+// Clients returns the number of client cursors, not counting the shared one.
+func (c *CursorSet) Clients() int {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.clients()
+}
+
+// clients counts the client cursors. Must be called with c.mutex held.
+func (c *CursorSet) clients() int {
+	n := len(c.cursors)
+	if _, ok := c.cursors[""]; ok {
+		n--
+	}
+	return n
+}
+
+// expire drops the cursors past their time. Must be called with c.mutex
+// held.
+func (c *CursorSet) expire(now time.Time) {
+	for id, cur := range c.cursors {
+		if !cur.expires.IsZero() && now.After(cur.expires) {
+			delete(c.cursors, id)
+		}
+	}
+}
+
+func (c *CursorSet) Render(f *FrameBuffer, old *FrameBuffer, tick uint64) {
+	c.mutex.Lock()
+	c.expire(time.Now())
+	shown := make([]*clientCursor, 0, len(c.cursors))
+	for id, cur := range c.cursors {
+		if id == "" && len(c.cursors) > 1 {
+			continue
+		}
+		shown = append(shown, cur)
+	}
+	c.mutex.Unlock()
+
+	// a fixed order, or overlapping cursors flicker
+	sort.Slice(shown, func(i, j int) bool { return shown[i].slot < shown[j].slot })
+	for _, cur := range shown {
+		cur.Render(f, old, tick)
+	}
+}
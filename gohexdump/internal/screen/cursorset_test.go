@@ -0,0 +1,168 @@
+package screen
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// testCursor is a Cursor that records where it is and when it is drawn.
+type testCursor struct {
+	name       string
+	brightness float64
+	x, y       int
+	rendered   *[]string
+}
+
+func (c *testCursor) SetCursor(x, y int) { c.x, c.y = x, y }
+
+func (c *testCursor) Render(f *FrameBuffer, old *FrameBuffer, tick uint64) {
+	*c.rendered = append(*c.rendered, c.name)
+}
+
+// newTestCursorSet returns a set whose cursors are named by the order they
+// are made in: c0, c1, ...
+func newTestCursorSet() (*CursorSet, *[]*testCursor, *[]string) {
+	var made []*testCursor
+	var rendered []string
+	c := NewCursorSet(func(brightness float64) Cursor {
+		cur := &testCursor{name: fmt.Sprintf("c%d", len(made)), brightness: brightness, rendered: &rendered}
+		made = append(made, cur)
+		return cur
+	})
+	return c, &made, &rendered
+}
+
+// render draws a frame and returns the cursors drawn, in order.
+func render(c *CursorSet, rendered *[]string) []string {
+	*rendered = nil
+	c.Render(nil, nil, 0)
+	return *rendered
+}
+
+func TestCursorSetShared(t *testing.T) {
+	c, made, rendered := newTestCursorSet()
+	c.SetCursor(3, 1)
+	if got := render(c, rendered); !reflect.DeepEqual(got, []string{"c0"}) {
+		t.Errorf("rendered %q, want the shared cursor", got)
+	}
+	if cur := (*made)[0]; cur.x != 3 || cur.y != 1 || cur.brightness != cursorLevels[0] {
+		t.Errorf("shared cursor %+v", cur)
+	}
+
+	// hidden while a client has a cursor, back once it is gone
+	c.SetCursorFor("phone", 5, 2, 0)
+	if got := render(c, rendered); !reflect.DeepEqual(got, []string{"c1"}) {
+		t.Errorf("rendered %q, want only the client cursor", got)
+	}
+	if n := c.Clients(); n != 1 {
+		t.Errorf("Clients = %d, want 1", n)
+	}
+	c.Expire("phone", 0)
+	time.Sleep(time.Millisecond)
+	if got := render(c, rendered); !reflect.DeepEqual(got, []string{"c0"}) {
+		t.Errorf("rendered %q after expiry, want the shared cursor", got)
+	}
+	if n := c.Clients(); n != 0 {
+		t.Errorf("Clients = %d, want 0", n)
+	}
+}
+
+func TestCursorSetSlots(t *testing.T) {
+	c, made, rendered := newTestCursorSet()
+	for _, id := range []string{"a", "b", "c", "d", "e"} {
+		c.SetCursorFor(id, 0, 0, 0)
+	}
+	for i, cur := range *made {
+		if want := cursorLevels[i%len(cursorLevels)]; cur.brightness != want {
+			t.Errorf("cursor %d brightness %v, want %v", i, cur.brightness, want)
+		}
+	}
+
+	// b's slot is reused by the next client
+	c.Expire("b", 0)
+	time.Sleep(time.Millisecond)
+	c.SetCursorFor("f", 0, 0, 0)
+	if f := (*made)[5]; f.brightness != cursorLevels[1] {
+		t.Errorf("new cursor brightness %v, want slot 1's %v", f.brightness, cursorLevels[1])
+	}
+
+	// drawn in slot order, every frame
+	want := []string{"c0", "c5", "c2", "c3", "c4"}
+	for i := 0; i < 20; i++ {
+		if got := render(c, rendered); !reflect.DeepEqual(got, want) {
+			t.Fatalf("frame %d rendered %q, want %q", i, got, want)
+		}
+	}
+}
+
+func TestCursorSetExpiry(t *testing.T) {
+	c, made, rendered := newTestCursorSet()
+
+	// a ttl lapses unless the cursor moves
+	c.SetCursorFor("web", 1, 1, 20*time.Millisecond)
+	c.SetCursorFor("port", 2, 2, 0)
+	time.Sleep(30 * time.Millisecond)
+	if got := render(c, rendered); !reflect.DeepEqual(got, []string{"c1"}) {
+		t.Errorf("rendered %q, want the web cursor gone", got)
+	}
+
+	// moving within the Expire grace keeps it, now without a deadline
+	c.Expire("port", 20*time.Millisecond)
+	c.SetCursorFor("port", 3, 2, 0)
+	time.Sleep(30 * time.Millisecond)
+	if got := render(c, rendered); !reflect.DeepEqual(got, []string{"c1"}) {
+		t.Errorf("rendered %q, want the port cursor kept", got)
+	}
+	if cur := (*made)[1]; cur.x != 3 {
+		t.Errorf("port cursor at %d, want 3", cur.x)
+	}
+
+	// expiring an unknown client is harmless
+	c.Expire("nobody", 0)
+
+	// not moved within the grace: gone
+	c.Expire("port", 20*time.Millisecond)
+	time.Sleep(30 * time.Millisecond)
+	if got := render(c, rendered); len(got) != 0 {
+		t.Errorf("rendered %q, want nothing", got)
+	}
+}
+
+func TestCursorSetLimit(t *testing.T) {
+	c, made, rendered := newTestCursorSet()
+	for i := 0; i < maxClientCursors+5; i++ {
+		c.SetCursorFor(fmt.Sprint(i), i, 0, 0)
+	}
+	if n := c.Clients(); n != maxClientCursors {
+		t.Errorf("Clients = %d, want %d", n, maxClientCursors)
+	}
+	if n := len(*made); n != maxClientCursors {
+		t.Errorf("%d cursors made, want %d", n, maxClientCursors)
+	}
+	if n := len(render(c, rendered)); n != maxClientCursors {
+		t.Errorf("%d cursors rendered, want %d", n, maxClientCursors)
+	}
+
+	// existing clients still move, and the shared cursor is not a client
+	c.SetCursorFor("0", 9, 3, 0)
+	if cur := (*made)[0]; cur.x != 9 || cur.y != 3 {
+		t.Errorf("cursor 0 at %d, %d, want 9, 3", cur.x, cur.y)
+	}
+	c.SetCursor(1, 1)
+	if n := c.Clients(); n != maxClientCursors {
+		t.Errorf("Clients = %d after the shared cursor", n)
+	}
+
+	// room again once one goes
+	c.Expire("3", 0)
+	time.Sleep(time.Millisecond)
+	c.SetCursorFor("late", 0, 0, 0)
+	if n := c.Clients(); n != maxClientCursors {
+		t.Errorf("Clients = %d, want %d", n, maxClientCursors)
+	}
+	if last := (*made)[len(*made)-1]; last.x != 0 || last.brightness != cursorLevels[3%len(cursorLevels)] {
+		t.Errorf("late cursor %+v, want slot 3", last)
+	}
+}
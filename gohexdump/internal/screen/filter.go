@@ -27,3 +27,18 @@ func (s *afterGlowFilter) Render(f *FrameBuffer, old *FrameBuffer, tick uint64)
 		}
 	}
 }
+
+type brightnessFilter struct {
+	factor float64
+}
+
+func NewBrightnessFilter(factor float64) Filter {
+	return &brightnessFilter{factor: math.Min(math.Max(0, factor), 1)}
+}
+
+func (s *brightnessFilter) Render(f *FrameBuffer, old *FrameBuffer, tick uint64) {
+
+	for i := range f.frame {
+		f.frame[i] *= s.factor
+	}
+}
@@ -0,0 +1,173 @@
+package screen
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"post6.net/gohexdump/internal/font"
+)
+
+// GlyphTransition animates a digit whose glyph changes on Update.
+type GlyphTransition int
+
+const (
+	NoTransition   GlyphTransition = iota
+	FadeTransition                 // segments going off fade out, those coming on fade in
+	FallTransition                 // segments going off fall away top first, those coming on grow from the bottom
+	FlapTransition                 // split-flap: the digit flips through the glyphs in between
+)
+
+var glyphTransitions = map[string]GlyphTransition{
+	"none": NoTransition,
+	"fade": FadeTransition,
+	"fall": FallTransition,
+	"flap": FlapTransition,
+}
+
+// GlyphTransitionNames returns the transition names, sorted.
+func GlyphTransitionNames() []string {
+	names := make([]string, 0, len(glyphTransitions))
+	for name := range glyphTransitions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func NamedGlyphTransition(name string) (GlyphTransition, error) {
+	if t, ok := glyphTransitions[name]; ok {
+		return t, nil
+	}
+	return NoTransition, fmt.Errorf("unknown transition %q", name)
+}
+
+// flapOrder is the order of the flaps on a split-flap digit.
+const flapOrder = " ABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+
+// maxFlaps limits how many flaps a change shows, ending at the new glyph.
+const maxFlaps = 8
+
+// segmentHeight is the height of each segment in a digit, 0 at the top to
+// 1 at the bottom, for staggering the fall and grow animations.
+var segmentHeight = func() (h [16]float64) {
+	min, max := math.Inf(1), math.Inf(-1)
+	for _, l := range segmentLocations {
+		min, max = math.Min(min, l.Y), math.Max(max, l.Y)
+	}
+	for i, l := range segmentLocations {
+		h[i] = (l.Y - min) / (max - min)
+	}
+	return h
+}()
+
+// SetTransition sets how digits change from one glyph to the next on
+// Update, taking d per change (per flap for FlapTransition).
+func (s *textScreen) SetTransition(t GlyphTransition, d time.Duration) {
+	frames := uint64(d.Seconds() * Fps)
+	if frames < 1 {
+		frames = 1
+	}
+	s.mutex.Lock()
+	s.transition, s.transFrames = t, frames
+	s.mutex.Unlock()
+}
+
+// startTransition begins animating digit i from its shown glyph to g.
+// Must be called with s.mutex held.
+func (s *textScreen) startTransition(i int, g font.Glyph) {
+	d := &s.digits[i]
+	shown := d.glyph
+	if d.moving && d.pending {
+		shown = d.from // not drawn yet
+	} else if d.moving {
+		shown = d.shown // not the glyph it was heading for, which would jump
+	}
+	d.from, d.moving, d.pending, d.flaps = shown, true, true, nil
+	if s.transition != FlapTransition {
+		return
+	}
+	glyphs := s.font.Glyphs(flapOrder)
+	from, to := flapIndex(glyphs, d.from), flapIndex(glyphs, g)
+	for ix := from; ix != to; {
+		ix = (ix + 1) % len(glyphs)
+		d.flaps = append(d.flaps, glyphs[ix])
+	}
+	if len(d.flaps) == 0 || d.flaps[len(d.flaps)-1] != g {
+		d.flaps = append(d.flaps, g) // not a flap of its own
+	}
+	if len(d.flaps) > maxFlaps {
+		d.flaps = d.flaps[len(d.flaps)-maxFlaps:]
+	}
+}
+
+func flapIndex(glyphs []font.Glyph, g font.Glyph) int {
+	for i, f := range glyphs {
+		if f == g {
+			return i
+		}
+	}
+	return 0
+}
+
+// renderTransition renders digit i, which is changing glyph, into dst.
+// It reports false once the transition is over. Must be called with
+// s.mutex held.
+func (s *textScreen) renderTransition(dst []float64, i int, style Style, tick uint64) bool {
+	d := &s.digits[i]
+	if d.pending {
+		d.pending, d.start = false, tick
+	}
+	age := tick - d.start
+
+	if s.transition == FlapTransition {
+		step := int(age / s.transFrames)
+		if step >= len(d.flaps) {
+			return false
+		}
+		d.shown = d.flaps[step]
+		style.Render(dst, d.flaps[step], i, tick)
+		if age%s.transFrames == 0 {
+			for j := range dst {
+				dst[j] *= .5 // the flap falling
+			}
+		}
+		return true
+	}
+
+	if age >= s.transFrames {
+		return false
+	}
+	p := float64(age) / float64(s.transFrames)
+	var from [16]float64
+	style.Render(from[:], d.from, i, tick)
+	style.Render(dst, d.glyph, i, tick)
+	d.shown = d.glyph
+	for j := range dst {
+		bit := font.Glyph(1) << uint(j)
+		on, was := d.glyph&bit != 0, d.from&bit != 0
+		if on == was {
+			continue
+		}
+		t := p // how far this segment is from its old to its new level
+		if s.transition == FallTransition {
+			if was {
+				t = stagger(p, segmentHeight[j])
+			} else {
+				t = stagger(p, 1-segmentHeight[j])
+			}
+		}
+		dst[j] = from[j]*(1-t) + dst[j]*t
+		if t < .5 {
+			d.shown ^= bit // still nearer its old level
+		}
+	}
+	return true
+}
+
+// stagger is progress p for a segment starting at delay, 0 to 1, of the
+// transition: each segment takes the last 40%.
+func stagger(p, delay float64) float64 {
+	return math.Max(0, math.Min(1, (p-delay*.6)/.4))
+}
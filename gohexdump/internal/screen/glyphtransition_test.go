@@ -0,0 +1,133 @@
+package screen
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"post6.net/gohexdump/internal/font"
+)
+
+// transitionFrames is the length of a transition in the tests.
+const transitionFrames = 10
+
+// newTransitionScreen returns a one-panel screen changing glyphs with t.
+func newTransitionScreen(t GlyphTransition) (*textScreen, *FrameBuffer) {
+	s := NewTextScreen(Configuration{{0, 0, HorizontalPanel}}).(*textScreen)
+	s.SetTransition(t, transitionFrames*time.Second/Fps)
+	return s, NewFrameBuffer(s.DigitCount())
+}
+
+// show writes text at the first digit.
+func show(s *textScreen, text string) {
+	s.Hold()
+	s.WriteAt(text, 0, 0)
+	s.Update()
+}
+
+// frames draws n frames, continuing from tick.
+func frames(s *textScreen, f *FrameBuffer, tick *uint64, n int) {
+	for i := 0; i < n; i++ {
+		s.NextFrame(f, f, *tick)
+		*tick++
+	}
+}
+
+func glyph(s *textScreen, r string) font.Glyph {
+	return s.font.Glyphs(r)[0]
+}
+
+func TestNoTransition(t *testing.T) {
+	s, f := newTransitionScreen(NoTransition)
+	want := NewFrameBuffer(s.DigitCount())
+	var tick uint64
+	for _, text := range []string{"A", "B", "8", " "} {
+		show(s, text)
+		frames(s, f, &tick, 1)
+		if s.digits[0].moving {
+			t.Errorf("%q: digit moving without a transition", text)
+		}
+		defaultStyle.Render(want.digits[0], glyph(s, text), 0, tick-1)
+		if !reflect.DeepEqual(f.digits[0], want.digits[0]) {
+			t.Errorf("%q: drawn %v, want %v at once", text, f.digits[0], want.digits[0])
+		}
+	}
+}
+
+func TestFlapSequence(t *testing.T) {
+	for _, test := range []struct {
+		from, to, flaps string
+	}{
+		{"A", "C", "BC"},
+		{"Y", "1", "Z01"},
+		{"9", "B", " AB"},      // wraps around the drum
+		{" ", "Z", "STUVWXYZ"}, // 26 flaps, the last maxFlaps shown
+		{"C", "A", "456789 A"}, // all the way round
+		{"A", "-", "456789 -"}, // not on the drum: round to the blank
+	} {
+		s, f := newTransitionScreen(FlapTransition)
+		var tick uint64
+		show(s, test.from)
+		frames(s, f, &tick, 2*transitionFrames*maxFlaps)
+
+		show(s, test.to)
+		want := s.font.Glyphs(test.flaps)
+		if got := s.digits[0].flaps; !reflect.DeepEqual(got, want) {
+			t.Errorf("%q to %q: flaps %v, want %q %v", test.from, test.to, got, test.flaps, want)
+			continue
+		}
+
+		// each flap is shown for transitionFrames, then the new glyph stays
+		var shown []font.Glyph
+		for i := 0; i < len(want)*transitionFrames; i++ {
+			frames(s, f, &tick, 1)
+			if i%transitionFrames == 0 {
+				shown = append(shown, s.digits[0].shown)
+			}
+		}
+		if !reflect.DeepEqual(shown, want) {
+			t.Errorf("%q to %q: showed %v, want %v", test.from, test.to, shown, want)
+		}
+		frames(s, f, &tick, 1)
+		if s.digits[0].moving {
+			t.Errorf("%q to %q: still moving after the last flap", test.from, test.to)
+		}
+	}
+}
+
+func TestTransitionRestart(t *testing.T) {
+	for _, test := range []struct {
+		name       string
+		transition GlyphTransition
+		frames     int    // drawn between the two changes
+		from       string // where the second change starts
+	}{
+		{"fade, not drawn yet", FadeTransition, 0, "A"},
+		{"fade, early", FadeTransition, 2, "A"},
+		{"fade, late", FadeTransition, 8, "F"},
+		{"flap, not drawn yet", FlapTransition, 0, "A"},
+		{"flap, first flap", FlapTransition, 1, "B"},
+		{"flap, midway", FlapTransition, 2*transitionFrames + 1, "D"},
+	} {
+		s, f := newTransitionScreen(test.transition)
+		var tick uint64
+		show(s, "A")
+		frames(s, f, &tick, 2*transitionFrames*maxFlaps)
+
+		show(s, "F") // flaps B C D E F
+		frames(s, f, &tick, test.frames)
+		show(s, "X")
+		d := s.digits[0]
+		if d.from != glyph(s, test.from) {
+			t.Errorf("%s: restarted from %v, want %q %v", test.name, d.from, test.from, glyph(s, test.from))
+		}
+		if !d.moving || !d.pending || d.glyph != glyph(s, "X") {
+			t.Errorf("%s: digit %+v, want a pending change to X", test.name, d)
+		}
+		if test.transition == FlapTransition {
+			if n := len(d.flaps); n != maxFlaps || d.flaps[n-1] != glyph(s, "X") {
+				t.Errorf("%s: flaps %v, want %d ending in X", test.name, d.flaps, maxFlaps)
+			}
+		}
+	}
+}
@@ -13,6 +13,8 @@ type HexScreen interface {
 	WriteRawAsciiField(g font.Glyph, field int)
 	WriteRawOffset(g []font.Glyph, line int)
 
+	HexFieldPosition(field int) (int, int)
+	AsciiFieldPosition(field int) (int, int)
 
 	WriteTitle(s string, start int)
 	WriteHexField(s string, field int)
@@ -80,6 +82,14 @@ func (t *hexScreen) WriteRawOffset(g []font.Glyph, line int) {
 }
 
 
+func (t *hexScreen) HexFieldPosition(field int) (int, int) {
+	return hexColumns[field%16], hexStartRow+(field/16)
+}
+
+func (t *hexScreen) AsciiFieldPosition(field int) (int, int) {
+	return asciiColumn+(field%16), hexStartRow+(field/16)
+}
+
 func (t *hexScreen) WriteTitle(s string, start int) {
 	t.WriteRawTitle(t.font.Glyphs(s), start)
 }
@@ -0,0 +1,100 @@
+package screen
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"post6.net/gohexdump/internal/font"
+)
+
+const segmentD = 1 << 3 // the bottom bar, used as an underline
+
+// Highlight kinds, for marking ranges such as an editor selection or
+// search hits.
+var highlights = map[string]func() Style{
+	// unlit segments dimly on behind the glyph
+	"invert": func() Style { return &SimpleStyle{fg: 1, bg: .25} },
+	// segment D lit under the glyph
+	"underline": func() Style { return &underlineStyle{fg: 1} },
+	// the glyph pulses
+	"pulse": func() Style { return NewBounce(.3, 1, time.Second) },
+}
+
+// HighlightNames returns the highlight kinds, sorted.
+func HighlightNames() []string {
+	names := make([]string, 0, len(highlights))
+	for name := range highlights {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// NewHighlight returns the style for a highlight kind.
+func NewHighlight(kind string) (Style, error) {
+	if f, ok := highlights[kind]; ok {
+		return f(), nil
+	}
+	return nil, fmt.Errorf("unknown highlight %q", kind)
+}
+
+// Mark is a highlighted run of Len digits on one row.
+type Mark struct {
+	Kind        string
+	Column, Row int
+	Len         int
+}
+
+// Highlight styles the digits under marks with SetStyleAt, replacing the
+// style they were written with. Call it after writing the text, between
+// Hold and Update. Marks off the screen are clipped.
+func Highlight(s TextScreen, marks []Mark) error {
+	styles := make(map[string]Style)
+	columns, _ := s.Size()
+	for _, m := range marks {
+		style, ok := styles[m.Kind]
+		if !ok {
+			var err error
+			if style, err = NewHighlight(m.Kind); err != nil {
+				return err
+			}
+			styles[m.Kind] = style
+		}
+		if m.Len <= 0 {
+			continue
+		}
+		start, n := m.Column, m.Len
+		if start < 0 {
+			// clip on the left first, so that the loop covers only the
+			// screen however far off it the mark starts
+			start, n = 0, n+start
+		}
+		if n > columns-start {
+			n = columns - start
+		}
+		for col := start; col < start+n; col++ {
+			s.SetStyleAt(style, col, m.Row)
+		}
+	}
+	return nil
+}
+
+type underlineStyle struct {
+	fg float64
+}
+
+func (s *underlineStyle) Apply() Style {
+	return s
+}
+
+func (s *underlineStyle) Render(dst []float64, glyph font.Glyph, frameIndex int, tick uint64) {
+	glyph |= segmentD
+	for i := range dst {
+		if glyph&(1<<uint(i)) != 0 {
+			dst[i] = s.fg
+		} else {
+			dst[i] = 0
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package screen
+
+import (
+	"math"
+	"testing"
+)
+
+// styleRecorder records the digits SetStyleAt is called for.
+type styleRecorder struct {
+	TextScreen
+	cells map[[2]int]Style
+	calls int
+}
+
+func (r *styleRecorder) SetStyleAt(style Style, column, row int) {
+	r.calls++
+	r.cells[[2]int{column, row}] = style
+	r.TextScreen.SetStyleAt(style, column, row)
+}
+
+func newStyleRecorder() *styleRecorder {
+	return &styleRecorder{
+		TextScreen: NewTextScreen(Configuration{{0, 0, HorizontalPanel}}),
+		cells:      make(map[[2]int]Style),
+	}
+}
+
+func TestHighlight(t *testing.T) {
+	for _, test := range []struct {
+		name  string
+		mark  Mark
+		cells []int // columns styled on the mark's row
+	}{
+		{"inside", Mark{"invert", 3, 0, 4}, []int{3, 4, 5, 6}},
+		{"left edge", Mark{"invert", -2, 0, 4}, []int{0, 1}},
+		{"right edge", Mark{"underline", 30, 0, 10}, []int{30, 31}},
+		{"off to the left", Mark{"invert", -10, 0, 5}, nil},
+		{"off to the right", Mark{"invert", 40, 0, 5}, nil},
+		{"empty", Mark{"invert", 3, 0, 0}, nil},
+		{"negative length", Mark{"invert", 3, 0, -5}, nil},
+		{"far left, long", Mark{"invert", -2000000000, 0, 2000000010}, []int{0, 1, 2, 3, 4, 5, 6, 7, 8, 9}},
+		{"extremes", Mark{"pulse", math.MinInt64 + 1, 0, math.MaxInt64}, nil},
+		{"whole row", Mark{"pulse", math.MinInt64 / 2, 0, math.MaxInt64}, []int{
+			0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15,
+			16, 17, 18, 19, 20, 21, 22, 23, 24, 25, 26, 27, 28, 29, 30, 31}},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			r := newStyleRecorder()
+			if err := Highlight(r, []Mark{test.mark}); err != nil {
+				t.Fatal(err)
+			}
+			if r.calls != len(test.cells) {
+				t.Errorf("%d SetStyleAt calls, want %d", r.calls, len(test.cells))
+			}
+			for _, col := range test.cells {
+				if _, ok := r.cells[[2]int{col, test.mark.Row}]; !ok {
+					t.Errorf("column %d not styled", col)
+				}
+			}
+		})
+	}
+}
+
+func TestHighlightKinds(t *testing.T) {
+	r := newStyleRecorder()
+	err := Highlight(r, []Mark{{"invert", 0, 0, 1}, {"underline", 1, 0, 1}, {"invert", 2, 0, 1}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.cells[[2]int{0, 0}] != r.cells[[2]int{2, 0}] {
+		t.Error("marks of one kind got different styles")
+	}
+	if r.cells[[2]int{0, 0}] == r.cells[[2]int{1, 0}] {
+		t.Error("marks of different kinds got the same style")
+	}
+
+	if err := Highlight(r, []Mark{{"sparkle", 0, 0, 1}}); err == nil {
+		t.Error("unknown kind accepted")
+	}
+}
@@ -0,0 +1,74 @@
+package screen
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// ParseMarkup splits text with style markup into runes and a style for
+// each: "{name}" switches to a named style (see StyleNames), "{/}" back to
+// the default, for which the style is nil. Braces around anything else,
+// "{}" included, are kept as text, so code and JSON pass through
+// unchanged. info lays out gradients.
+func ParseMarkup(text string, info ScreenInfo) ([]rune, []Style) {
+	var runes []rune
+	var styles []Style
+	var cur Style
+	cache := make(map[string]Style)
+
+	for len(text) > 0 {
+		if name, n, ok := markupTag(text); ok {
+			if name == "" {
+				cur = nil
+			} else if style, ok := cache[name]; ok {
+				cur = style
+			} else {
+				cur, _ = NamedStyle(name, info)
+				cache[name] = cur
+			}
+			text = text[n:]
+			continue
+		}
+		r, n := utf8.DecodeRuneInString(text)
+		runes = append(runes, r)
+		styles = append(styles, cur)
+		text = text[n:]
+	}
+	return runes, styles
+}
+
+// StripMarkup returns text without its style markup.
+func StripMarkup(text string) string {
+	var b strings.Builder
+	for len(text) > 0 {
+		if _, n, ok := markupTag(text); ok {
+			text = text[n:]
+			continue
+		}
+		r, n := utf8.DecodeRuneInString(text)
+		b.WriteRune(r)
+		text = text[n:]
+	}
+	return b.String()
+}
+
+// markupTag reports whether text starts with "{/}" or "{name}" for a named
+// style, returning the lowercased name ("" for "{/}") and the length of the
+// tag.
+func markupTag(text string) (string, int, bool) {
+	if text[0] != '{' {
+		return "", 0, false
+	}
+	end := strings.IndexByte(text, '}')
+	if end < 0 {
+		return "", 0, false
+	}
+	name := strings.ToLower(text[1:end])
+	if name == "/" {
+		return "", end + 1, true
+	}
+	if _, ok := namedStyles[name]; !ok {
+		return "", 0, false
+	}
+	return name, end + 1, true
+}
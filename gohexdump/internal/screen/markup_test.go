@@ -0,0 +1,69 @@
+package screen
+
+import (
+	"reflect"
+	"testing"
+)
+
+// markupStyles names the styles in the tests by a letter; '.' is the
+// default.
+var markupStyles = map[byte]string{'i': "inverse", 'b': "blink", 'g': "gradient"}
+
+func TestParseMarkup(t *testing.T) {
+	info := NewTextScreen(Configuration{{0, 0, HorizontalPanel}})
+	for _, test := range []struct {
+		in, text, styles string
+	}{
+		{"", "", ""},
+		{"plain", "plain", "....."},
+		{"a{inverse}bc{/}d", "abcd", ".ii."},
+		{"{INVERSE}x{Blink}y", "xy", "ib"},
+		{"{inverse}{blink}x", "x", "b"},
+		{"{gradient}é{/}{/}ü", "éü", "g."},
+		{"{blink}on to the end", "on to the end", "bbbbbbbbbbbbb"},
+
+		// not markup
+		{"{}", "{}", ".."},
+		{"{inverse}x{}y", "x{}y", "iiii"},
+		{`{"a":{}}`, `{"a":{}}`, "........"},
+		{"if x {return}", "if x {return}", "............."},
+		{"{nope}x", "{nope}x", "......."},
+		{"{inverse", "{inverse", "........"},
+		{"{//}", "{//}", "...."},
+		{"}{/", "}{/", "..."},
+	} {
+		runes, styles := ParseMarkup(test.in, info)
+		if string(runes) != test.text {
+			t.Errorf("ParseMarkup(%q) text = %q, want %q", test.in, string(runes), test.text)
+			continue
+		}
+		if len(styles) != len(runes) {
+			t.Errorf("ParseMarkup(%q): %d styles for %d runes", test.in, len(styles), len(runes))
+			continue
+		}
+		for i, style := range styles {
+			name, ok := markupStyles[test.styles[i]]
+			if !ok {
+				if style != nil {
+					t.Errorf("ParseMarkup(%q) rune %d has style %T, want none", test.in, i, style)
+				}
+				continue
+			}
+			want, _ := NamedStyle(name, info)
+			if reflect.TypeOf(style) != reflect.TypeOf(want) {
+				t.Errorf("ParseMarkup(%q) rune %d has style %T, want %s", test.in, i, style, name)
+			}
+		}
+		if got := StripMarkup(test.in); got != test.text {
+			t.Errorf("StripMarkup(%q) = %q, want %q", test.in, got, test.text)
+		}
+	}
+}
+
+func TestParseMarkupSharesStyles(t *testing.T) {
+	// a style's state (a blink phase, say) carries across its tags
+	_, styles := ParseMarkup("{blink}a{/}b{blink}c", NewTextScreen(Configuration{{0, 0, HorizontalPanel}}))
+	if styles[0] == nil || styles[0] != styles[2] {
+		t.Errorf("styles %v, want the same blink for a and c", styles)
+	}
+}
@@ -0,0 +1,43 @@
+package screen
+
+import (
+	"math"
+)
+
+type plasmaScreen struct {
+	coords     []Vector2
+	center     Vector2
+	brightness float64
+	speed      float64
+}
+
+// NewPlasmaScreen returns the classic sum-of-sines plasma, sampled at every
+// segment. speed scales how fast it moves; 1 is a slow drift.
+func NewPlasmaScreen(info ScreenInfo, brightness, speed float64) Screen {
+	dim := info.Dimensions()
+	return &plasmaScreen{
+		coords:     info.Coords(),
+		center:     Vector2{dim.X / 2, dim.Y / 2},
+		brightness: math.Max(0, math.Min(1, brightness)),
+		speed:      speed,
+	}
+}
+
+func (p *plasmaScreen) NextFrame(f, old *FrameBuffer, tick uint64) bool {
+
+	t := float64(tick) / Fps * p.speed
+	k := 2 * math.Pi / (digitSize.Y * 4) // wavelength of about four rows
+
+	for i, c := range p.coords {
+		if i%16 == 15 {
+			continue // unused segment slot
+		}
+		dx, dy := c.X-p.center.X, c.Y-p.center.Y
+		v := math.Sin(c.X*k*.5+t) +
+			math.Sin(c.Y*k+t*1.3) +
+			math.Sin((c.X+c.Y)*k*.35+t*.7) +
+			math.Sin(math.Sqrt(dx*dx+dy*dy)*k*.8-t*1.1)
+		f.frame[i] = p.brightness * (v + 4) / 8
+	}
+	return true
+}
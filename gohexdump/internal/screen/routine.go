@@ -5,6 +5,7 @@ import (
 	"time"
 	"fmt"
 	"flag"
+	"post6.net/gohexdump/internal/metrics"
 )
 
 const Fps = 60
@@ -17,6 +18,21 @@ func init() {
 }
 
 
+var (
+	fpsGauge = metrics.NewGauge("hexboard_fps",
+		"Frames written to the output during the last second.")
+	frameSeconds = metrics.NewHistogram("hexboard_frame_seconds",
+		"Time spent rendering one frame (Screen.NextFrame and filters).",
+		metrics.ExponentialBuckets(.0005, 2, 8))
+	writeSeconds = metrics.NewHistogram("hexboard_output_write_seconds",
+		"Latency of Output.Write.",
+		metrics.ExponentialBuckets(.0005, 2, 8))
+	writeErrors = metrics.NewCounter("hexboard_output_write_errors_total",
+		"Output.Write calls that returned an error.")
+	writesSkipped = metrics.NewCounter("hexboard_output_writes_skipped_total",
+		"Frames not written because the output was already dark.")
+)
+
 type Output interface {
 
 	Write(dst []float64) (int, error)
@@ -27,6 +43,7 @@ func DisplayRoutine(out Output, s Screen, info ScreenInfo, quit <-chan bool) {
 	var counter, prev_counter uint64
 	var frames = []*FrameBuffer { NewFrameBuffer(info.DigitCount()), NewFrameBuffer(info.DigitCount()) }
 	cur, old := 0, 1
+	dark := false // the last frame written was all zero
 
 	if !s.NextFrame(frames[cur], frames[old], counter) {
 		return
@@ -46,22 +63,46 @@ func DisplayRoutine(out Output, s Screen, info ScreenInfo, quit <-chan bool) {
 
 			case <-tick.C:
 
-				out.Write(frames[cur].frame)
+				// a dark board stays dark: skip the write until there is
+				// something to show
+				blank := isDark(frames[cur].frame)
+				if blank && dark {
+					writesSkipped.Inc()
+				} else {
+					start := time.Now()
+					if _, err := out.Write(frames[cur].frame); err != nil {
+						writeErrors.Inc()
+					}
+					writeSeconds.Observe(time.Since(start).Seconds())
+					dark = blank
+				}
+
 				cur, old = old, cur
 				counter++
 				frames[cur].Clear()
+
+				start := time.Now()
 				if !s.NextFrame(frames[cur], frames[old], counter) {
 					return
 				}
+				frameSeconds.Observe(time.Since(start).Seconds())
 
 			case <-seconds.C:
 				if verbose {
 					fmt.Printf("fps: %d\n", counter-prev_counter)
 				}
+				fpsGauge.Set(float64(counter-prev_counter))
 				prev_counter = counter
 		}
 	}
 
 }
 
-
+func isDark(frame []float64) bool {
+	for _, v := range frame {
+		if v != 0 {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,62 @@
+package screen
+
+import "math"
+
+const (
+	segmentGap   = .4  // between the end of a segment and the node it meets
+	segmentWidth = .9  // of a bar
+	dpSize       = 1.1 // side of the decimal point
+)
+
+// segmentEnds are the end points of each bar segment, A to N, relative to
+// the digit, found from the segment centres: the bars meet at nine nodes on
+// the slanted outline and centre lines of the digit.
+var segmentEnds = func() (ends [14][2]Vector2) {
+	l := segmentLocations
+	top, mid, bottom := l[0].Y, (l[6].Y+l[7].Y)/2, l[3].Y
+	slant := (l[4].X - l[5].X) / (l[4].Y - l[5].Y)
+	left := func(y float64) Vector2 { return Vector2{l[5].X + slant*(y-l[5].Y), y} }
+	right := func(y float64) Vector2 { return Vector2{l[1].X + slant*(y-l[1].Y), y} }
+
+	tl, tc, tr := left(top), l[0], right(top)
+	ml, mc, mr := left(mid), Vector2{(l[6].X + l[7].X) / 2, mid}, right(mid)
+	bl, bc, br := left(bottom), l[3], right(bottom)
+
+	return [14][2]Vector2{
+		{tl, tr}, {tr, mr}, {mr, br}, {bl, br}, {ml, bl}, {tl, ml}, // A to F
+		{ml, mc}, {mc, mr}, // G1, G2
+		{tl, mc}, {tc, mc}, {tr, mc}, {mc, br}, {mc, bc}, {mc, bl}, // H to N
+	}
+}()
+
+// SegmentPolygon returns the outline of segment ix on the screen, in the
+// same units as SegmentCoord: a bar with pointed ends, or a square for the
+// decimal point. It returns nil for the unused slot in each digit.
+func SegmentPolygon(info ScreenInfo, ix int) []Vector2 {
+	seg := ix & 0xf
+	if seg == 15 {
+		return nil
+	}
+	o := info.DigitCoord(ix >> 4)
+	if seg == 14 {
+		c, h := segmentLocations[seg], dpSize/2
+		return []Vector2{
+			{o.X + c.X - h, o.Y + c.Y - h}, {o.X + c.X + h, o.Y + c.Y - h},
+			{o.X + c.X + h, o.Y + c.Y + h}, {o.X + c.X - h, o.Y + c.Y + h},
+		}
+	}
+
+	p, q := segmentEnds[seg][0], segmentEnds[seg][1]
+	dx, dy := q.X-p.X, q.Y-p.Y
+	n := math.Hypot(dx, dy)
+	dx, dy = dx/n, dy/n
+	w := segmentWidth / 2
+	at := func(along, across float64) Vector2 {
+		return Vector2{o.X + p.X + dx*along - dy*across, o.Y + p.Y + dy*along + dx*across}
+	}
+	a, b := segmentGap, n-segmentGap
+	return []Vector2{
+		at(a, 0), at(a+w, w), at(b-w, w),
+		at(b, 0), at(b-w, -w), at(a+w, -w),
+	}
+}
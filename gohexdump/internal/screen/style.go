@@ -2,7 +2,10 @@
 package screen
 
 import (
+	"fmt"
 	"math"
+	"sort"
+	"strings"
 	"time"
 	"post6.net/gohexdump/internal/font"
 	"post6.net/gohexdump/internal/demomath/wave"
@@ -72,3 +75,40 @@ func NewBounce(min, max float64, period time.Duration) Style {
 	return &PeriodicStyle{ wave:wave.Wave, fgBase: min, fgAmp: max-min, multiplier: m}
 }
 
+func NewBlink(min, max float64, period time.Duration) Style {
+	min, max = math.Max(0, min), math.Min(1., max)
+	m := uint64(wave.Multiplier) / uint64(period)
+	return &PeriodicStyle{ wave:wave.Square, fgBase: min, fgAmp: max-min, multiplier: m}
+}
+
+// namedStyles are the styles for STYLE, hextail and the message markup.
+// info lays out the gradients.
+var namedStyles = map[string]func(info ScreenInfo) Style{
+	"bright":    func(ScreenInfo) Style { return NewBrightness(1) },
+	"normal":    func(ScreenInfo) Style { return NewBrightness(.6) },
+	"dim":       func(ScreenInfo) Style { return NewBrightness(.3) },
+	"bounce":    func(ScreenInfo) Style { return NewBounce(.2, 1, time.Second) },
+	"pulse":     func(ScreenInfo) Style { return NewBounce(.5, 1, 2*time.Second) },
+	"blink":     func(ScreenInfo) Style { return NewBlink(0, 1, time.Second) },
+	"inverse":   func(ScreenInfo) Style { return NewInverse(.8) },
+	"outline":   func(ScreenInfo) Style { return NewOutline(1, .3) },
+	"ghost":     func(ScreenInfo) Style { return NewGhost(1, .2) },
+	"gradient":  func(info ScreenInfo) Style { return NewGradient(info, .2, 1, 0) },
+	"vgradient": func(info ScreenInfo) Style { return NewGradient(info, 1, .2, 90) },
+}
+
+func StyleNames() []string {
+	names := make([]string, 0, len(namedStyles))
+	for name := range namedStyles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func NamedStyle(name string, info ScreenInfo) (Style, error) {
+	if f, ok := namedStyles[strings.ToLower(name)]; ok {
+		return f(info), nil
+	}
+	return nil, fmt.Errorf("unknown style %q", name)
+}
@@ -3,6 +3,7 @@ package screen
 
 import (
 	"sync"
+	"time"
 	"post6.net/gohexdump/internal/font"
 	"post6.net/gohexdump/internal/util/clip"
 	"errors"
@@ -71,6 +72,9 @@ type TextScreen interface {
 	SetStyle(s Style)
 	SetStyleAt(s Style, column, row int)
 
+	/* animate glyph changes on Update */
+	SetTransition(t GlyphTransition, d time.Duration)
+
 	WriteRawAt(g []font.Glyph, column, row int) (int, int, error)
 	WriteAt(s string, column, row int) (int, int, error)
 
@@ -102,6 +106,13 @@ type screenPos struct { column, row int }
 type digit struct {
 	glyph font.Glyph
 	style Style
+
+	// glyph transition, see SetTransition
+	from font.Glyph
+	shown font.Glyph // nearest glyph to the frame last drawn
+	flaps []font.Glyph
+	start uint64
+	moving, pending bool
 }
 
 type textScreen struct {
@@ -115,6 +126,9 @@ type textScreen struct {
 	font *font.Font
 	held bool
 	mutex sync.Mutex
+
+	transition GlyphTransition
+	transFrames uint64
 }
 
 type Panel struct {
@@ -295,6 +309,12 @@ func (s *textScreen) NextFrame(f, old *FrameBuffer, tick uint64) bool {
 		if style == nil {
 			style = defaultStyle
 		}
+		if s.digits[i].moving {
+			if s.renderTransition(f.digits[i], i, style, tick) {
+				continue
+			}
+			s.digits[i].moving = false
+		}
 		style.Render(f.digits[i], s.digits[i].glyph, i, tick)
 	}
 	s.mutex.Unlock()
@@ -313,6 +333,9 @@ func (s *textScreen) Update() {
 	s.mutex.Lock()
 	for i := range s.staging {
 		style, glyph := s.staging[i].style, s.staging[i].glyph
+		if s.transition != NoTransition && glyph != s.digits[i].glyph {
+			s.startTransition(i, glyph)
+		}
 //		if style != nil {
 			s.digits[i].style = style
 			s.digits[i].glyph = glyph
@@ -0,0 +1,57 @@
+package screen
+
+import (
+	"time"
+)
+
+type blankScreen struct{}
+
+// Blank shows nothing. DisplayRoutine stops writing to the output once it
+// has written one dark frame, so a blank board costs no serial bandwidth.
+var Blank Screen = blankScreen{}
+
+func (blankScreen) NextFrame(f, old *FrameBuffer, tick uint64) bool {
+	return true
+}
+
+type crossfade struct {
+	from, to  Screen
+	frames, n int
+	cur, prev *FrameBuffer // from's own frames, so its filters see its history
+}
+
+// NewCrossfade fades from one screen into another over d, then shows only
+// to. Send it into a MultiScreen in place of to for a smooth switch; use
+// Blank to fade in from or out to nothing.
+func NewCrossfade(from, to Screen, d time.Duration) Screen {
+	frames := int(d.Seconds() * Fps)
+	if frames < 1 {
+		frames = 1
+	}
+	return &crossfade{from: from, to: to, frames: frames}
+}
+
+func (c *crossfade) NextFrame(f, old *FrameBuffer, tick uint64) bool {
+	if c.n >= c.frames {
+		return c.to.NextFrame(f, old, tick)
+	}
+	c.n++
+
+	if c.cur == nil {
+		c.cur, c.prev = NewFrameBuffer(len(f.digits)), NewFrameBuffer(len(f.digits))
+	}
+	c.cur, c.prev = c.prev, c.cur
+	c.cur.Clear()
+	if !c.from.NextFrame(c.cur, c.prev, tick) {
+		c.n = c.frames // from has ended: skip to the new screen
+	}
+	if !c.to.NextFrame(f, old, tick) {
+		return false
+	}
+
+	t := float64(c.n) / float64(c.frames)
+	for i, v := range c.cur.frame {
+		f.frame[i] = t*f.frame[i] + (1-t)*v
+	}
+	return true
+}
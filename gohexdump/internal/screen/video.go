@@ -0,0 +1,137 @@
+package screen
+
+import (
+	"encoding/binary"
+	"hash/fnv"
+	"io"
+	"math"
+	"sync"
+
+	"post6.net/gohexdump/internal/segvideo"
+)
+
+// LayoutHash identifies the segment layout of info: video made for one
+// layout is meaningless on another with the same number of segments.
+func LayoutHash(info ScreenInfo) uint64 {
+	h := fnv.New64a()
+	b := make([]byte, 8)
+	for _, c := range info.Coords() {
+		for _, v := range []float64{c.X, c.Y} {
+			binary.LittleEndian.PutUint64(b, uint64(int64(math.Round(v*1000)))) // in µm, so rounding does not matter
+			h.Write(b)
+		}
+	}
+	return h.Sum64()
+}
+
+// VideoScreen plays segment video as written by encvid. It loops at the
+// end of the video.
+type VideoScreen struct {
+	r   *segvideo.Reader
+	fps float64
+	buf []float64
+	// index of the frame in buf, -1 before the first
+	frame int64
+
+	mutex sync.Mutex
+	start uint64 // display tick at which playback (re)started
+	begun bool
+	err   error
+}
+
+// NewVideoScreen plays r at fps, or at the rate of the video if fps is 0.
+func NewVideoScreen(r *segvideo.Reader, fps float64) *VideoScreen {
+	h := r.Header()
+	if fps <= 0 {
+		fps = h.FPS
+	}
+	return &VideoScreen{
+		r:     r,
+		fps:   fps,
+		buf:   make([]float64, h.Segments),
+		frame: -1,
+	}
+}
+
+// OpenVideo reads video for info from r: segment video, which must have
+// been made for info's layout, or headerless raw video of one byte per
+// segment. fps overrides the rate of the video; raw video defaults to 30
+// frames per second and gamma 2.5.
+func OpenVideo(r io.ReadSeeker, info ScreenInfo, fps float64) (*VideoScreen, error) {
+	v, err := segvideo.NewReader(r)
+	if err == segvideo.ErrNoHeader {
+		if _, err = r.Seek(0, io.SeekStart); err != nil {
+			return nil, err
+		}
+		rawFps := fps
+		if rawFps <= 0 {
+			rawFps = 30
+		}
+		v, err = segvideo.NewRawReader(r, info.SegmentCount(), rawFps, 2.5)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := v.Check(info.SegmentCount(), LayoutHash(info)); err != nil {
+		return nil, err
+	}
+	return NewVideoScreen(v, fps), nil
+}
+
+// Err returns the read error that stopped playback, if any.
+func (v *VideoScreen) Err() error {
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+	return v.err
+}
+
+// Restart plays from the first frame on the next call to NextFrame.
+func (v *VideoScreen) Restart() {
+	v.mutex.Lock()
+	v.begun = false
+	v.mutex.Unlock()
+}
+
+func (v *VideoScreen) NextFrame(f, old *FrameBuffer, tick uint64) bool {
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+
+	if !v.begun {
+		v.begun, v.start, v.frame = true, tick, -1
+		v.err = v.r.Seek(0)
+	}
+
+	want := int64(float64(tick-v.start) * v.fps / Fps)
+	if behind := want - v.frame; v.err == nil && float64(behind) > v.fps {
+		// not shown for a while: skip ahead rather than read every frame
+		if n := int64(v.r.Frames()); n > 0 {
+			v.start += uint64(float64(want/n*n) * Fps / v.fps)
+			want %= n
+		}
+		v.err = v.r.Seek(int(want))
+		v.frame = want - 1
+	}
+	for v.err == nil && v.frame < want {
+		err := v.r.ReadFrame(v.buf)
+		if err == io.EOF {
+			if v.frame == -1 {
+				v.err = io.ErrUnexpectedEOF // not even one frame
+				break
+			}
+			// loop
+			v.start, want, v.frame = tick, 0, -1
+			v.err = v.r.Seek(0)
+			continue
+		}
+		if err != nil {
+			v.err = err
+			break
+		}
+		v.frame++
+	}
+
+	if v.frame >= 0 {
+		copy(f.frame, v.buf)
+	}
+	return true
+}
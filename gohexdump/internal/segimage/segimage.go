@@ -0,0 +1,327 @@
+// Package segimage converts grayscale images to segment frames. Each
+// segment takes the area-weighted average of the image under its outline
+// (see screen.SegmentPolygon) rather than the one pixel at its centre, so
+// that fine detail does not alias. Levels can be dithered across segments,
+// or matched to font glyphs for text art. It is used by encvid.
+package segimage
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"sort"
+
+	"post6.net/gohexdump/internal/font"
+	"post6.net/gohexdump/internal/screen"
+)
+
+const (
+	maxSampleStep = .1 // largest spacing of the points sampling a segment, in screen units
+	ditherRadius  = 4. // how far quantisation error spreads, in screen units
+	ditherShares  = 4  // segments that each error spreads to
+)
+
+type weight struct {
+	index  int // pixel, or segment for dithering
+	weight float64
+}
+
+// Converter turns frames of one size into segment levels for one screen.
+// Averaging and dithering happen in linear light: pixel values are
+// decoded with gamma, and levels encoded again by Encode.
+type Converter struct {
+	width, height int
+	gamma         float64
+	lin           [256]float64
+	weights       [][]weight // pixels under each segment; nil for the unused slots
+
+	order  []int      // segments in scan order, for dithering
+	shares [][]weight // later segments each one's error spreads to
+}
+
+// NewConverter returns a converter for w×h pixel frames, stretched over the
+// segments of info, with pixel values encoded with gamma (as for playvid).
+func NewConverter(info screen.ScreenInfo, w, h int, gamma float64) *Converter {
+	c := newConverter(info, w, h, gamma)
+
+	polys := make([][]screen.Vector2, len(c.weights))
+	min, max := bounds(info, func(i int) []screen.Vector2 {
+		polys[i] = screen.SegmentPolygon(info, i)
+		return polys[i]
+	})
+	sx, sy := float64(w)/(max.X-min.X), float64(h)/(max.Y-min.Y)
+	step := math.Min(maxSampleStep, .5/math.Max(sx, sy)) // at least two points per pixel
+
+	for i, poly := range polys {
+		if poly == nil {
+			continue
+		}
+		pmin, pmax := polyBounds(poly)
+		counts := make(map[int]float64)
+		for y := pmin.Y + step/2; y < pmax.Y; y += step {
+			for x := pmin.X + step/2; x < pmax.X; x += step {
+				if inside(poly, x, y) {
+					px := clamp(int((x-min.X)*sx), w)
+					py := clamp(int((y-min.Y)*sy), h)
+					counts[px+py*w]++
+				}
+			}
+		}
+		c.weights[i] = normalize(counts)
+	}
+	return c
+}
+
+// NewPointConverter returns a converter that takes each segment from the
+// one pixel at its centre, as encvid used to.
+func NewPointConverter(info screen.ScreenInfo, w, h int, gamma float64) *Converter {
+	c := newConverter(info, w, h, gamma)
+
+	min, max := bounds(info, func(i int) []screen.Vector2 {
+		return []screen.Vector2{info.SegmentCoord(i)}
+	})
+	fx, fy := float64(w-1)/(max.X-min.X), float64(h-1)/(max.Y-min.Y)
+
+	for i := range c.weights {
+		if i&0xf == 0xf {
+			continue
+		}
+		p := info.SegmentCoord(i)
+		x := clamp(int((p.X-min.X)*fx), w)
+		y := clamp(int((p.Y-min.Y)*fy), h)
+		c.weights[i] = []weight{{x + y*w, 1}}
+	}
+	return c
+}
+
+func newConverter(info screen.ScreenInfo, w, h int, gamma float64) *Converter {
+	c := &Converter{
+		width:   w,
+		height:  h,
+		gamma:   gamma,
+		weights: make([][]weight, info.SegmentCount()),
+	}
+	for i := range c.lin {
+		c.lin[i] = math.Pow(float64(i)/255, gamma)
+	}
+
+	// Dithering spreads each segment's error to the nearest segments after
+	// it in scan order, top to bottom and left to right, nearer ones
+	// getting more.
+	coords := info.Coords()
+	for i := range coords {
+		if i&0xf != 0xf {
+			c.order = append(c.order, i)
+		}
+	}
+	sort.Slice(c.order, func(a, b int) bool {
+		p, q := coords[c.order[a]], coords[c.order[b]]
+		if p.Y != q.Y {
+			return p.Y < q.Y
+		}
+		return p.X < q.X
+	})
+	c.shares = make([][]weight, len(coords))
+	for n, i := range c.order {
+		var near []weight
+		for _, j := range c.order[n+1:] {
+			d := math.Hypot(coords[j].X-coords[i].X, coords[j].Y-coords[i].Y)
+			if d < ditherRadius {
+				near = append(near, weight{j, d})
+			}
+		}
+		sort.Slice(near, func(a, b int) bool { return near[a].weight < near[b].weight })
+		if len(near) > ditherShares {
+			near = near[:ditherShares]
+		}
+		counts := make(map[int]float64)
+		for _, s := range near {
+			counts[s.index] = 1 / math.Max(s.weight, .1)
+		}
+		c.shares[i] = normalize(counts)
+	}
+	return c
+}
+
+// Size returns the frame size the converter takes.
+func (c *Converter) Size() (int, int) {
+	return c.width, c.height
+}
+
+// Levels sets the linear level of every segment for a frame of one
+// byte per pixel, row by row.
+func (c *Converter) Levels(pix []byte, levels []float64) {
+	for i, ws := range c.weights {
+		v := 0.
+		for _, w := range ws {
+			if w.index < len(pix) {
+				v += c.lin[pix[w.index]] * w.weight
+			}
+		}
+		levels[i] = v
+	}
+}
+
+// Encode replaces levels with their encoded values, 0 to 1, in steps
+// evenly spaced values (2 to 65536), as stored in video. With dither, the
+// error of each segment is carried to its neighbours, so areas keep their
+// brightness.
+func (c *Converter) Encode(levels []float64, steps int, dither bool) {
+	if steps < 2 {
+		steps = 2
+	} else if steps > 1<<16 {
+		steps = 1 << 16
+	}
+	top := float64(steps - 1)
+	for i := range levels {
+		if i&0xf == 0xf {
+			levels[i] = 0
+		}
+	}
+	for _, i := range c.order {
+		v := math.Max(0, math.Min(1, levels[i]))
+		q := math.Round(math.Pow(v, 1/c.gamma)*top) / top
+		if dither {
+			e := levels[i] - math.Pow(q, c.gamma)
+			for _, s := range c.shares[i] {
+				levels[s.index] += e * s.weight
+			}
+		}
+		levels[i] = q
+	}
+}
+
+// Text replaces the levels of every digit with the glyph in glyphs that
+// matches them best, lit at the mean level under it: text art. The decimal
+// point is left as it is. Encode its levels without dither, which would
+// spread light into the segments the glyphs leave off.
+func Text(levels []float64, glyphs []font.Glyph) {
+	const mask = 1<<14 - 1
+	for d := 0; d+16 <= len(levels); d += 16 {
+		seg := levels[d : d+14]
+		best, bestLevel, bestErr := font.Glyph(0), 0., math.Inf(1)
+		for _, g := range glyphs {
+			g &= mask
+			level, err := fit(seg, g)
+			if err < bestErr {
+				best, bestLevel, bestErr = g, level, err
+			}
+		}
+		for i := range seg {
+			if best&(1<<uint(i)) != 0 {
+				seg[i] = bestLevel
+			} else {
+				seg[i] = 0
+			}
+		}
+	}
+}
+
+// fit returns the level to light glyph g at to match seg, and the squared
+// error left.
+func fit(seg []float64, g font.Glyph) (float64, float64) {
+	sum, n := 0., 0
+	for i, v := range seg {
+		if g&(1<<uint(i)) != 0 {
+			sum += v
+			n++
+		}
+	}
+	level := 0.
+	if n > 0 {
+		level = sum / float64(n)
+	}
+	err := 0.
+	for i, v := range seg {
+		if g&(1<<uint(i)) != 0 {
+			v -= level
+		}
+		err += v * v
+	}
+	return level, err
+}
+
+// FontGlyphs returns the distinct glyphs f has for printable ASCII.
+func FontGlyphs(f *font.Font) []font.Glyph {
+	seen := make(map[font.Glyph]bool)
+	var glyphs []font.Glyph
+	for r := rune(' '); r <= '~'; r++ {
+		if g := f.GetGlyph(r); !seen[g] {
+			seen[g] = true
+			glyphs = append(glyphs, g)
+		}
+	}
+	return glyphs
+}
+
+// Gray returns img as one byte per pixel, row by row.
+func Gray(img image.Image) ([]byte, int, int) {
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	pix := make([]byte, w*h)
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			pix[x+y*w] = color.GrayModel.Convert(img.At(b.Min.X+x, b.Min.Y+y)).(color.Gray).Y
+		}
+	}
+	return pix, w, h
+}
+
+// bounds returns the bounding box of the points shape gives for every
+// segment.
+func bounds(info screen.ScreenInfo, shape func(i int) []screen.Vector2) (screen.Vector2, screen.Vector2) {
+	min := screen.Vector2{X: math.Inf(1), Y: math.Inf(1)}
+	max := screen.Vector2{X: math.Inf(-1), Y: math.Inf(-1)}
+	for i := 0; i < info.SegmentCount(); i++ {
+		for _, p := range shape(i) {
+			min.X, min.Y = math.Min(min.X, p.X), math.Min(min.Y, p.Y)
+			max.X, max.Y = math.Max(max.X, p.X), math.Max(max.Y, p.Y)
+		}
+	}
+	return min, max
+}
+
+func polyBounds(poly []screen.Vector2) (screen.Vector2, screen.Vector2) {
+	min, max := poly[0], poly[0]
+	for _, p := range poly[1:] {
+		min.X, min.Y = math.Min(min.X, p.X), math.Min(min.Y, p.Y)
+		max.X, max.Y = math.Max(max.X, p.X), math.Max(max.Y, p.Y)
+	}
+	return min, max
+}
+
+// inside reports whether (x, y) is inside poly, by the even-odd rule.
+func inside(poly []screen.Vector2, x, y float64) bool {
+	in := false
+	for i, j := 0, len(poly)-1; i < len(poly); j, i = i, i+1 {
+		p, q := poly[i], poly[j]
+		if (p.Y > y) != (q.Y > y) && x < p.X+(y-p.Y)*(q.X-p.X)/(q.Y-p.Y) {
+			in = !in
+		}
+	}
+	return in
+}
+
+// normalize turns amounts by index into weights adding up to 1.
+func normalize(amounts map[int]float64) []weight {
+	total := 0.
+	for _, n := range amounts {
+		total += n
+	}
+	ws := make([]weight, 0, len(amounts))
+	for ix, n := range amounts {
+		ws = append(ws, weight{ix, n / total})
+	}
+	sort.Slice(ws, func(a, b int) bool { return ws[a].index < ws[b].index })
+	return ws
+}
+
+func clamp(v, n int) int {
+	if v < 0 {
+		return 0
+	}
+	if v >= n {
+		return n - 1
+	}
+	return v
+}
@@ -0,0 +1,221 @@
+package segimage
+
+import (
+	"math"
+	"testing"
+
+	"post6.net/gohexdump/internal/font"
+	"post6.net/gohexdump/internal/screen"
+)
+
+func testScreen() screen.ScreenInfo {
+	return screen.NewTextScreen(screen.Configuration{{Column: 0, Row: 0, Type: screen.HorizontalPanel}})
+}
+
+// checkers returns a w×h frame of black and white pixels in turn.
+func checkers(w, h int) []byte {
+	pix := make([]byte, w*h)
+	for y := 0; y < h; y++ {
+		for x := (y + 1) % 2; x < w; x += 2 {
+			pix[x+y*w] = 255
+		}
+	}
+	return pix
+}
+
+func TestWeights(t *testing.T) {
+	info := testScreen()
+	const w, h = 64, 16
+	for _, c := range []*Converter{NewConverter(info, w, h, 2), NewPointConverter(info, w, h, 2)} {
+		for i, ws := range c.weights {
+			if i&0xf == 0xf {
+				if ws != nil {
+					t.Errorf("unused segment %d has weights", i)
+				}
+				continue
+			}
+			total := 0.
+			for _, wt := range ws {
+				if wt.index < 0 || wt.index >= w*h {
+					t.Errorf("segment %d weighs pixel %d, outside the frame", i, wt.index)
+				}
+				total += wt.weight
+			}
+			if math.Abs(total-1) > 1e-9 {
+				t.Errorf("segment %d weights add up to %v", i, total)
+			}
+		}
+	}
+}
+
+func TestLevels(t *testing.T) {
+	info := testScreen()
+	const w, h = 64, 16
+	levels := make([]float64, info.SegmentCount())
+
+	// a flat gray is the same, linear, level everywhere
+	gray := make([]byte, w*h)
+	for i := range gray {
+		gray[i] = 128
+	}
+	c := NewConverter(info, w, h, 2)
+	c.Levels(gray, levels)
+	want := math.Pow(128./255, 2)
+	for i, v := range levels {
+		if i&0xf != 0xf && math.Abs(v-want) > 1e-9 {
+			t.Fatalf("segment %d = %v, want %v", i, v, want)
+		}
+	}
+
+	// detail finer than the segments: point sampling is all or nothing,
+	// while areas average it
+	pix := checkers(w, h)
+	between := func(c *Converter) int {
+		c.Levels(pix, levels)
+		n := 0
+		for _, v := range levels {
+			if v < -1e-9 || v > 1+1e-9 {
+				t.Fatalf("level %v out of range", v)
+			}
+			if v > .01 && v < .99 {
+				n++
+			}
+		}
+		return n
+	}
+	if n := between(NewPointConverter(info, w, h, 2)); n != 0 {
+		t.Errorf("point sampling: %d segments in between", n)
+	}
+	if n, used := between(NewConverter(info, w, h, 2)), info.SegmentCount()*15/16; n != used {
+		t.Errorf("area sampling: %d of %d segments in between", n, used)
+	}
+	lit := 0.
+	for _, v := range levels {
+		lit += v
+	}
+	if used := float64(info.SegmentCount()) * 15 / 16; math.Abs(lit/used-.5) > .1 {
+		t.Errorf("half the pixels white light the segments %.2f, want about half", lit/used)
+	}
+}
+
+// fill returns levels of v for every used segment.
+func fill(info screen.ScreenInfo, v float64) []float64 {
+	levels := make([]float64, info.SegmentCount())
+	for i := range levels {
+		if i&0xf != 0xf {
+			levels[i] = v
+		}
+	}
+	return levels
+}
+
+// mean returns the mean of the used segments, and whether they are all 0
+// or 1.
+func mean(levels []float64) (float64, bool) {
+	sum, n, binary := 0., 0, true
+	for i, v := range levels {
+		if i&0xf == 0xf {
+			continue
+		}
+		sum += v
+		n++
+		binary = binary && (v == 0 || v == 1)
+	}
+	return sum / float64(n), binary
+}
+
+func TestEncodeDither(t *testing.T) {
+	info := testScreen()
+	for _, gamma := range []float64{1, 2.5} {
+		c := NewConverter(info, 8, 8, gamma)
+		for _, level := range []float64{.1, .3, .5, .8} {
+			plain := fill(info, level)
+			c.Encode(plain, 2, false)
+			m, binary := mean(plain)
+			if !binary || (m != 0 && m != 1) {
+				t.Errorf("gamma %v, %v without dither: mean %v, want all on or all off", gamma, level, m)
+			}
+
+			dithered := fill(info, level)
+			c.Encode(dithered, 2, true)
+			m, binary = mean(dithered)
+			if !binary {
+				t.Errorf("gamma %v, %v dithered: levels %v, want 0 or 1", gamma, level, dithered)
+			}
+			// on or off, the encoded value is also the linear one
+			if math.Abs(m-level) > .1 {
+				t.Errorf("gamma %v, %v dithered: mean %v", gamma, level, m)
+			}
+		}
+	}
+
+	// the unused slots are cleared, and more steps round to the nearest
+	c := NewConverter(info, 8, 8, 1)
+	levels := fill(info, .26)
+	levels[15] = 1
+	c.Encode(levels, 5, false)
+	if levels[15] != 0 {
+		t.Errorf("unused slot encoded as %v", levels[15])
+	}
+	if levels[0] != .25 {
+		t.Errorf("0.26 in 5 steps = %v, want 0.25", levels[0])
+	}
+}
+
+func TestText(t *testing.T) {
+	f := font.GetFont()
+	glyphs := FontGlyphs(f)
+	seen := make(map[font.Glyph]bool)
+	for _, g := range glyphs {
+		if seen[g] {
+			t.Errorf("glyph %v twice", g)
+		}
+		seen[g] = true
+	}
+
+	// digits drawn as glyphs, a little noisy, come back as those glyphs
+	text := []rune("AL74")
+	brightness := []float64{.7, .4, 1, .5}
+	levels := make([]float64, 16*len(text))
+	for d, r := range text {
+		g := f.GetGlyph(r)
+		for i := 0; i < 14; i++ {
+			if g&(1<<uint(i)) != 0 {
+				levels[d*16+i] = brightness[d] - .02*float64(i%3)
+			} else {
+				levels[d*16+i] = .03 * float64(i%2)
+			}
+		}
+		levels[d*16+14] = .6 // the decimal point
+	}
+	Text(levels, glyphs)
+
+	for d, r := range text {
+		g := f.GetGlyph(r)
+		for i := 0; i < 14; i++ {
+			v := levels[d*16+i]
+			if g&(1<<uint(i)) == 0 {
+				if v != 0 {
+					t.Errorf("%q segment %d = %v, want off", r, i, v)
+				}
+			} else if math.Abs(v-(brightness[d]-.02)) > .02 {
+				t.Errorf("%q segment %d = %v, want about %v", r, i, v, brightness[d]-.02)
+			}
+		}
+		if levels[d*16+14] != .6 {
+			t.Errorf("%q decimal point = %v, want it left as it was", r, levels[d*16+14])
+		}
+	}
+}
+
+func TestFit(t *testing.T) {
+	seg := make([]float64, 14)
+	seg[0], seg[1], seg[5] = .4, .6, .1
+	level, err := fit(seg, 1<<0|1<<1)
+	if math.Abs(level-.5) > 1e-9 || math.Abs(err-(.01+.01+.01)) > 1e-9 {
+		t.Errorf("fit = %v, %v, want 0.5, 0.03", level, err)
+	}
+	if level, err := fit(seg, 0); level != 0 || math.Abs(err-(.16+.36+.01)) > 1e-9 {
+		t.Errorf("fit of the blank = %v, %v, want 0, 0.53", level, err)
+	}
+}
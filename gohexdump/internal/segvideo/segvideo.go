@@ -0,0 +1,401 @@
+// Package segvideo reads and writes segment video: frames of one sample
+// per segment, as written by encvid and played by playvid and the video
+// playlist entry.
+//
+// A file starts with a header describing the frames, so that players know
+// the rate and gamma and can refuse video made for another screen. All
+// numbers are little-endian:
+//
+//	magic     "HXVD"
+//	version   uint8    1
+//	bits      uint8    8 or 16, per sample
+//	reserved  uint16   0
+//	segments  uint32   samples per frame
+//	fps       float32
+//	gamma     float32  samples are brightness^(1/gamma), scaled to the bits
+//	layout    uint64   hash of the segment positions, see screen.LayoutHash
+//
+// The frames follow, then, when the writer was closed, a seek index and a
+// trailer:
+//
+//	count     uint32
+//	entries   count × {frame uint32, offset uint64}, one per second
+//	index     uint64   offset of count
+//	magic     "HXVI"
+//
+// Headerless raw video, one byte per segment, as encvid wrote before, is
+// read by NewRawReader.
+package segvideo
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+)
+
+const (
+	magic      = "HXVD"
+	indexMagic = "HXVI"
+	version    = 1
+
+	headerSize  = 28
+	trailerSize = 12
+	entrySize   = 12
+
+	maxSegments = 1 << 20
+)
+
+// ErrNoHeader is returned by NewReader for data that does not start with a
+// segment video header, such as raw video.
+var ErrNoHeader = errors.New("segvideo: no header")
+
+// Header describes the frames in a file.
+type Header struct {
+	Bits     int // 8 or 16
+	Segments int
+	FPS      float64
+	Gamma    float64
+	Layout   uint64
+}
+
+func (h Header) check() error {
+	switch {
+	case h.Bits != 8 && h.Bits != 16:
+		return fmt.Errorf("segvideo: %d bits per sample, want 8 or 16", h.Bits)
+	case h.Segments <= 0 || h.Segments > maxSegments:
+		return fmt.Errorf("segvideo: %d segments", h.Segments)
+	case !(h.FPS > 0 && h.FPS <= 1000):
+		return fmt.Errorf("segvideo: fps %v", h.FPS)
+	case !(h.Gamma > 0 && h.Gamma <= 10):
+		return fmt.Errorf("segvideo: gamma %v", h.Gamma)
+	}
+	return nil
+}
+
+func (h Header) frameSize() int64 {
+	return int64(h.Segments * h.Bits / 8)
+}
+
+// Writer writes segment video.
+type Writer struct {
+	w      *bufio.Writer
+	header Header
+	raw    bool
+	buf    []byte
+	offset int64
+	frames int
+	every  int // frames between index entries
+	index  []entry
+}
+
+type entry struct {
+	frame  uint32
+	offset uint64
+}
+
+// NewWriter writes the header for h to w, returning a writer for the
+// frames.
+func NewWriter(w io.Writer, h Header) (*Writer, error) {
+	if err := h.check(); err != nil {
+		return nil, err
+	}
+	vw := &Writer{
+		w:      bufio.NewWriter(w),
+		header: h,
+		buf:    make([]byte, h.frameSize()),
+		offset: headerSize,
+		every:  int(math.Max(1, math.Round(h.FPS))),
+	}
+	b := make([]byte, headerSize)
+	copy(b, magic)
+	b[4], b[5] = version, byte(h.Bits)
+	binary.LittleEndian.PutUint32(b[8:], uint32(h.Segments))
+	binary.LittleEndian.PutUint32(b[12:], math.Float32bits(float32(h.FPS)))
+	binary.LittleEndian.PutUint32(b[16:], math.Float32bits(float32(h.Gamma)))
+	binary.LittleEndian.PutUint64(b[20:], h.Layout)
+	if _, err := vw.w.Write(b); err != nil {
+		return nil, err
+	}
+	return vw, nil
+}
+
+// NewRawWriter returns a writer of headerless raw video: one byte per
+// segment, without an index.
+func NewRawWriter(w io.Writer, segments int) *Writer {
+	return &Writer{
+		w:      bufio.NewWriter(w),
+		header: Header{Bits: 8, Segments: segments},
+		raw:    true,
+		buf:    make([]byte, segments),
+	}
+}
+
+// WriteFrame writes a frame of encoded samples, 0 to 1, one per segment.
+func (w *Writer) WriteFrame(samples []float64) error {
+	if len(samples) != w.header.Segments {
+		return fmt.Errorf("segvideo: frame of %d samples, want %d", len(samples), w.header.Segments)
+	}
+	if !w.raw && w.frames%w.every == 0 {
+		w.index = append(w.index, entry{uint32(w.frames), uint64(w.offset)})
+	}
+	for i, v := range samples {
+		v = math.Max(0, math.Min(1, v))
+		if w.header.Bits == 16 {
+			binary.LittleEndian.PutUint16(w.buf[2*i:], uint16(math.Round(v*0xffff)))
+		} else {
+			w.buf[i] = byte(math.Round(v * 0xff))
+		}
+	}
+	if _, err := w.w.Write(w.buf); err != nil {
+		return err
+	}
+	w.offset += int64(len(w.buf))
+	w.frames++
+	return nil
+}
+
+// Close writes the seek index and flushes. It does not close the
+// underlying writer.
+func (w *Writer) Close() error {
+	if !w.raw {
+		b := make([]byte, 4+entrySize*len(w.index)+trailerSize)
+		binary.LittleEndian.PutUint32(b, uint32(len(w.index)))
+		for i, e := range w.index {
+			binary.LittleEndian.PutUint32(b[4+entrySize*i:], e.frame)
+			binary.LittleEndian.PutUint64(b[8+entrySize*i:], e.offset)
+		}
+		t := b[len(b)-trailerSize:]
+		binary.LittleEndian.PutUint64(t, uint64(w.offset))
+		copy(t[8:], indexMagic)
+		if _, err := w.w.Write(b); err != nil {
+			return err
+		}
+	}
+	return w.w.Flush()
+}
+
+// Reader reads segment video. Seeking needs an io.ReadSeeker; from a pipe
+// frames can only be read in order.
+type Reader struct {
+	r      io.Reader
+	s      io.Seeker // nil if r cannot seek
+	header Header
+	raw    bool
+	buf    []byte
+	gmap   []float64 // sample to brightness, for 8 bits
+	frames int       // -1 if not known
+	next   int       // frame ReadFrame reads
+	index  []entry
+}
+
+// NewReader reads and checks the header of segment video from r, and its
+// seek index if r can seek. Data without a header gives ErrNoHeader.
+func NewReader(r io.Reader) (*Reader, error) {
+	b := make([]byte, headerSize)
+	if _, err := io.ReadFull(r, b); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return nil, ErrNoHeader
+		}
+		return nil, err
+	}
+	if string(b[:4]) != magic {
+		return nil, ErrNoHeader
+	}
+	if b[4] != version {
+		return nil, fmt.Errorf("segvideo: version %d, want %d", b[4], version)
+	}
+	h := Header{
+		Bits:     int(b[5]),
+		Segments: int(binary.LittleEndian.Uint32(b[8:])),
+		FPS:      float64(math.Float32frombits(binary.LittleEndian.Uint32(b[12:]))),
+		Gamma:    float64(math.Float32frombits(binary.LittleEndian.Uint32(b[16:]))),
+		Layout:   binary.LittleEndian.Uint64(b[20:]),
+	}
+	if err := h.check(); err != nil {
+		return nil, err
+	}
+	vr := newReader(r, h, false)
+	if vr.s != nil {
+		if err := vr.readIndex(); err != nil {
+			return nil, err
+		}
+	}
+	return vr, nil
+}
+
+// NewRawReader reads headerless raw video: one byte per segment, at fps,
+// encoded with gamma.
+func NewRawReader(r io.Reader, segments int, fps, gamma float64) (*Reader, error) {
+	h := Header{Bits: 8, Segments: segments, FPS: fps, Gamma: gamma}
+	if err := h.check(); err != nil {
+		return nil, err
+	}
+	vr := newReader(r, h, true)
+	if vr.s != nil {
+		size, err := vr.s.Seek(0, io.SeekEnd)
+		if err == nil {
+			vr.frames = int(size / h.frameSize())
+			_, err = vr.s.Seek(0, io.SeekStart)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return vr, nil
+}
+
+func newReader(r io.Reader, h Header, raw bool) *Reader {
+	vr := &Reader{r: r, header: h, raw: raw, buf: make([]byte, h.frameSize()), frames: -1}
+	if s, ok := r.(io.Seeker); ok {
+		if _, err := s.Seek(0, io.SeekCurrent); err == nil {
+			vr.s = s // not a pipe
+		}
+	}
+	if h.Bits == 8 {
+		vr.gmap = make([]float64, 256)
+		for i := range vr.gmap {
+			vr.gmap[i] = math.Pow(float64(i)/0xff, h.Gamma)
+		}
+	}
+	return vr
+}
+
+// readIndex finds the number of frames, from the trailer if there is one
+// or else from the size, and checks the index against the frame size.
+func (r *Reader) readIndex() error {
+	size, err := r.s.Seek(0, io.SeekEnd)
+	if err != nil {
+		return err
+	}
+	end := size
+	t := make([]byte, trailerSize)
+	if size >= headerSize+4+trailerSize {
+		if _, err := r.s.Seek(size-trailerSize, io.SeekStart); err != nil {
+			return err
+		}
+		if _, err := io.ReadFull(r.r, t); err != nil {
+			return err
+		}
+	}
+	if string(t[8:]) == indexMagic {
+		at := int64(binary.LittleEndian.Uint64(t))
+		if at < headerSize || at > size-4-trailerSize {
+			return fmt.Errorf("segvideo: bad index offset %d", at)
+		}
+		b := make([]byte, size-trailerSize-at)
+		if _, err := r.s.Seek(at, io.SeekStart); err != nil {
+			return err
+		}
+		if _, err := io.ReadFull(r.r, b); err != nil {
+			return err
+		}
+		n := int64(binary.LittleEndian.Uint32(b))
+		if 4+n*entrySize != int64(len(b)) {
+			return fmt.Errorf("segvideo: index of %d entries in %d bytes", n, len(b))
+		}
+		r.index = make([]entry, n)
+		for i := range r.index {
+			r.index[i] = entry{
+				binary.LittleEndian.Uint32(b[4+entrySize*i:]),
+				binary.LittleEndian.Uint64(b[8+entrySize*i:]),
+			}
+		}
+		end = at
+	}
+
+	if (end-headerSize)%r.header.frameSize() != 0 && r.index != nil {
+		return fmt.Errorf("segvideo: %d bytes of frames is not a whole number of frames", end-headerSize)
+	}
+	r.frames = int((end - headerSize) / r.header.frameSize())
+	for i, e := range r.index {
+		if int(e.frame) >= r.frames || (i > 0 && e.frame <= r.index[i-1].frame) ||
+			int64(e.offset) != headerSize+int64(e.frame)*r.header.frameSize() {
+			return fmt.Errorf("segvideo: bad index entry %d", i)
+		}
+	}
+	_, err = r.s.Seek(headerSize, io.SeekStart)
+	return err
+}
+
+// Header returns the header read, or for raw video the one given.
+func (r *Reader) Header() Header {
+	return r.header
+}
+
+// Raw reports whether the video has no header.
+func (r *Reader) Raw() bool {
+	return r.raw
+}
+
+// Frames returns the number of frames, or -1 if it is not known because
+// the reader cannot seek.
+func (r *Reader) Frames() int {
+	return r.frames
+}
+
+// Check returns an error unless the video was made for a screen with the
+// given number of segments and layout hash. Raw video is only checked
+// for its frame size.
+func (r *Reader) Check(segments int, layout uint64) error {
+	if r.header.Segments != segments {
+		return fmt.Errorf("segvideo: video has %d segments, screen has %d", r.header.Segments, segments)
+	}
+	if !r.raw && r.header.Layout != layout {
+		return fmt.Errorf("segvideo: video made for another segment layout (%016x, screen is %016x)", r.header.Layout, layout)
+	}
+	return nil
+}
+
+// Seek moves to frame, so that ReadFrame reads it next.
+func (r *Reader) Seek(frame int) error {
+	if r.s == nil {
+		return errors.New("segvideo: cannot seek")
+	}
+	if frame < 0 || frame > r.frames {
+		return fmt.Errorf("segvideo: seek to frame %d of %d", frame, r.frames)
+	}
+	offset := int64(0)
+	if !r.raw {
+		offset = headerSize
+	}
+	n := frame
+	if i := sort.Search(len(r.index), func(i int) bool { return int(r.index[i].frame) > frame }); i > 0 {
+		offset, n = int64(r.index[i-1].offset), frame-int(r.index[i-1].frame)
+	}
+	if _, err := r.s.Seek(offset+int64(n)*r.header.frameSize(), io.SeekStart); err != nil {
+		return err
+	}
+	r.next = frame
+	return nil
+}
+
+// ReadFrame reads the next frame into dst as brightness, 0 to 1, one per
+// segment. It returns io.EOF after the last frame.
+func (r *Reader) ReadFrame(dst []float64) error {
+	if r.frames >= 0 && r.next >= r.frames {
+		return io.EOF // not into the index
+	}
+	if _, err := io.ReadFull(r.r, r.buf); err != nil {
+		if err == io.ErrUnexpectedEOF {
+			err = io.EOF // a partial frame at the end
+		}
+		return err
+	}
+	r.next++
+	if r.gmap != nil {
+		for i, b := range r.buf {
+			if i < len(dst) {
+				dst[i] = r.gmap[b]
+			}
+		}
+		return nil
+	}
+	for i := 0; i < len(r.buf)/2 && i < len(dst); i++ {
+		dst[i] = math.Pow(float64(binary.LittleEndian.Uint16(r.buf[2*i:]))/0xffff, r.header.Gamma)
+	}
+	return nil
+}
@@ -0,0 +1,254 @@
+package segvideo
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"os"
+	"strings"
+	"testing"
+)
+
+const (
+	testSegments = 100 // a frame is larger than the seek index written
+	testFrames   = 25
+	testFPS      = 10
+	testGamma    = 2
+	testLayout   = 0x1234
+)
+
+// sample is the encoded sample written for segment i of frame.
+func sample(frame, i int) float64 {
+	return float64((frame*7+i*3)%256) / 255
+}
+
+func testHeader(bits int) Header {
+	return Header{Bits: bits, Segments: testSegments, FPS: testFPS, Gamma: testGamma, Layout: testLayout}
+}
+
+// encode returns a closed video of testFrames frames.
+func encode(t *testing.T, bits int) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	w, err := NewWriter(&buf, testHeader(bits))
+	if err != nil {
+		t.Fatal(err)
+	}
+	frame := make([]float64, testSegments)
+	for f := 0; f < testFrames; f++ {
+		for i := range frame {
+			frame[i] = sample(f, i)
+		}
+		if err := w.WriteFrame(frame); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// checkFrame reads the next frame from r and compares it with frame f as
+// written, allowing for the quantisation of bits.
+func checkFrame(t *testing.T, r *Reader, f int) {
+	t.Helper()
+	got := make([]float64, testSegments)
+	if err := r.ReadFrame(got); err != nil {
+		t.Fatalf("frame %d: %v", f, err)
+	}
+	// a sample is off by at most half a step, which gamma magnifies
+	tolerance := testGamma * .5 / float64(int(1)<<uint(r.Header().Bits)-1)
+	for i, v := range got {
+		if want := math.Pow(sample(f, i), testGamma); math.Abs(v-want) > tolerance {
+			t.Fatalf("frame %d segment %d = %v, want %v", f, i, v, want)
+		}
+	}
+}
+
+func checkEOF(t *testing.T, r *Reader) {
+	t.Helper()
+	if err := r.ReadFrame(make([]float64, testSegments)); err != io.EOF {
+		t.Fatalf("ReadFrame past the end = %v, want io.EOF", err)
+	}
+}
+
+func tempFile(t *testing.T, data []byte) (*os.File, func()) {
+	t.Helper()
+	f, err := ioutil.TempFile("", "segvideo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cleanup := func() {
+		f.Close()
+		os.Remove(f.Name())
+	}
+	if _, err := f.Write(data); err != nil {
+		cleanup()
+		t.Fatal(err)
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		cleanup()
+		t.Fatal(err)
+	}
+	return f, cleanup
+}
+
+func TestRoundTrip(t *testing.T) {
+	for _, bits := range []int{8, 16} {
+		t.Run(fmt.Sprintf("%d bits", bits), func(t *testing.T) {
+			data := encode(t, bits)
+
+			// from a pipe: frames in order, no seeking
+			r, err := NewReader(bytes.NewBuffer(data))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if h := r.Header(); h != testHeader(bits) {
+				t.Errorf("Header = %+v, want %+v", h, testHeader(bits))
+			}
+			if n := r.Frames(); n != -1 {
+				t.Errorf("Frames from a pipe = %d, want -1", n)
+			}
+			for f := 0; f < testFrames; f++ {
+				checkFrame(t, r, f)
+			}
+			checkEOF(t, r) // the index is read as a partial frame
+			if err := r.Seek(0); err == nil {
+				t.Error("Seek on a pipe succeeded")
+			}
+
+			// from a file: frame count from the index, and seeking
+			f, cleanup := tempFile(t, data)
+			defer cleanup()
+			r, err = NewReader(f)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if n := r.Frames(); n != testFrames {
+				t.Errorf("Frames = %d, want %d", n, testFrames)
+			}
+			if got, want := len(r.index), (testFrames+testFPS-1)/testFPS; got != want {
+				t.Errorf("%d index entries, want %d", got, want)
+			}
+			for f := 0; f < testFrames; f++ {
+				checkFrame(t, r, f)
+			}
+			checkEOF(t, r)
+
+			for _, frame := range []int{13, 0, 20, testFrames - 1, 9, 10} {
+				if err := r.Seek(frame); err != nil {
+					t.Fatalf("Seek(%d): %v", frame, err)
+				}
+				checkFrame(t, r, frame)
+			}
+			if err := r.Seek(testFrames); err != nil {
+				t.Fatalf("Seek to the end: %v", err)
+			}
+			checkEOF(t, r)
+			for _, frame := range []int{-1, testFrames + 1} {
+				if err := r.Seek(frame); err == nil {
+					t.Errorf("Seek(%d) succeeded", frame)
+				}
+			}
+		})
+	}
+}
+
+func TestTruncated(t *testing.T) {
+	data := encode(t, 16)
+	frameSize := int(testHeader(16).frameSize())
+	// cut mid-frame, losing the index and trailer, as a killed encvid leaves it
+	data = data[:headerSize+10*frameSize+frameSize/2]
+
+	r, err := NewReader(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := r.Frames(); n != 10 {
+		t.Errorf("Frames = %d, want 10 whole frames", n)
+	}
+	if r.index != nil {
+		t.Errorf("index %v read from a truncated file", r.index)
+	}
+	for f := 0; f < 10; f++ {
+		checkFrame(t, r, f)
+	}
+	checkEOF(t, r)
+	if err := r.Seek(7); err != nil {
+		t.Fatal(err)
+	}
+	checkFrame(t, r, 7)
+}
+
+func TestRaw(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewRawWriter(&buf, testSegments)
+	frame := make([]float64, testSegments)
+	for f := 0; f < testFrames; f++ {
+		for i := range frame {
+			frame[i] = sample(f, i)
+		}
+		if err := w.WriteFrame(frame); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if buf.Len() != testFrames*testSegments {
+		t.Fatalf("raw video of %d bytes, want %d", buf.Len(), testFrames*testSegments)
+	}
+
+	if _, err := NewReader(bytes.NewReader(buf.Bytes())); err != ErrNoHeader {
+		t.Fatalf("NewReader on raw video: %v, want ErrNoHeader", err)
+	}
+	if _, err := NewReader(bytes.NewReader(nil)); err != ErrNoHeader {
+		t.Fatalf("NewReader on nothing: %v, want ErrNoHeader", err)
+	}
+
+	r, err := NewRawReader(bytes.NewReader(buf.Bytes()), testSegments, testFPS, testGamma)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !r.Raw() {
+		t.Error("Raw = false")
+	}
+	if n := r.Frames(); n != testFrames {
+		t.Errorf("Frames = %d, want %d", n, testFrames)
+	}
+	for f := 0; f < testFrames; f++ {
+		checkFrame(t, r, f)
+	}
+	checkEOF(t, r)
+	if err := r.Seek(3); err != nil {
+		t.Fatal(err)
+	}
+	checkFrame(t, r, 3)
+
+	// raw video has no layout to check, only its frame size
+	if err := r.Check(testSegments, testLayout+1); err != nil {
+		t.Errorf("Check of raw video: %v", err)
+	}
+	if err := r.Check(testSegments+1, testLayout); err == nil {
+		t.Error("Check accepted raw video of the wrong frame size")
+	}
+}
+
+func TestCheck(t *testing.T) {
+	r, err := NewReader(bytes.NewReader(encode(t, 8)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Check(testSegments, testLayout); err != nil {
+		t.Errorf("Check of a matching screen: %v", err)
+	}
+	if err := r.Check(testSegments, testLayout+1); err == nil || !strings.Contains(err.Error(), "layout") {
+		t.Errorf("Check with another layout = %v, want a layout error", err)
+	}
+	if err := r.Check(testSegments*2, testLayout); err == nil || !strings.Contains(err.Error(), "segments") {
+		t.Errorf("Check with another segment count = %v, want a segments error", err)
+	}
+}
@@ -0,0 +1,105 @@
+package store
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"os"
+)
+
+// migrations is the ordered list of schema changes. migrations[i] upgrades
+// the database from schema version i to i+1; the version is kept in SQLite's
+// user_version pragma. Append new entries — never edit or reorder old ones,
+// because deployed databases have already applied them.
+//
+// Version 0 is a database written before migrations existed: it may already
+// contain the messages table, so migration 1 must stay idempotent.
+var migrations = []string{
+	// 1: initial messages table
+	`CREATE TABLE IF NOT EXISTS messages (
+		id      INTEGER  PRIMARY KEY AUTOINCREMENT,
+		type    TEXT     NOT NULL DEFAULT 'text',
+		content TEXT     NOT NULL,
+		sent_at DATETIME NOT NULL
+	)`,
+}
+
+// schemaVersion returns the version recorded in the database.
+func schemaVersion(db *sql.DB) (int, error) {
+	var v int
+	err := db.QueryRow(`PRAGMA user_version`).Scan(&v)
+	return v, err
+}
+
+// migrate brings the database at path up to len(migrations).
+// If any migration is pending and the database already holds a schema, a copy
+// is written to <path>.v<N>.bak first (N = current version). Each migration
+// runs in its own transaction together with the user_version bump, so a
+// failure leaves the database at the last fully applied version.
+// Returns an error if the database is newer than this binary understands.
+func migrate(db *sql.DB, path string) error {
+	version, err := schemaVersion(db)
+	if err != nil {
+		return fmt.Errorf("read schema version: %v", err)
+	}
+	if version > len(migrations) {
+		return fmt.Errorf("schema version %d is newer than supported version %d", version, len(migrations))
+	}
+	if version == len(migrations) {
+		return nil
+	}
+
+	if err := backup(db, path, version); err != nil {
+		return fmt.Errorf("backup before migration: %v", err)
+	}
+
+	for v := version; v < len(migrations); v++ {
+		if err := applyMigration(db, v+1, migrations[v]); err != nil {
+			return fmt.Errorf("migration %d: %v", v+1, err)
+		}
+		log.Printf("store: migrated schema to version %d", v+1)
+	}
+	return nil
+}
+
+func applyMigration(db *sql.DB, version int, stmt string) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	if _, err := tx.Exec(stmt); err != nil {
+		tx.Rollback()
+		return err
+	}
+	// PRAGMA does not accept bound parameters; version is an int we control.
+	if _, err := tx.Exec(fmt.Sprintf(`PRAGMA user_version = %d`, version)); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// backup writes a consistent copy of the database next to path using
+// VACUUM INTO. Fresh and in-memory databases are not backed up.
+// An existing backup for the same version is left untouched.
+func backup(db *sql.DB, path string, version int) error {
+	if path == Memory {
+		return nil
+	}
+	var tables int
+	if err := db.QueryRow(`SELECT count(*) FROM sqlite_master WHERE type = 'table'`).Scan(&tables); err != nil {
+		return err
+	}
+	if tables == 0 {
+		return nil
+	}
+	dst := fmt.Sprintf("%s.v%d.bak", path, version)
+	if _, err := os.Stat(dst); err == nil {
+		return nil
+	}
+	if _, err := db.Exec(`VACUUM INTO ?`, dst); err != nil {
+		return err
+	}
+	log.Printf("store: backed up schema version %d to %s", version, dst)
+	return nil
+}
@@ -0,0 +1,206 @@
+package store
+
+import (
+	"database/sql"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// fixtures create databases as earlier versions of hexboard left them.
+var fixtures = map[int][]string{
+	// 0: before migrations, the schema was created on every start
+	0: {
+		`CREATE TABLE IF NOT EXISTS messages (
+			id      INTEGER  PRIMARY KEY AUTOINCREMENT,
+			type    TEXT     NOT NULL DEFAULT 'text',
+			content TEXT     NOT NULL,
+			sent_at DATETIME NOT NULL
+		)`,
+	},
+	// 1: the first migration
+	1: {
+		migrations[0],
+		`PRAGMA user_version = 1`,
+	},
+}
+
+// fixture writes a database at schema version in dir holding messages,
+// and returns its path.
+func fixture(t *testing.T, dir string, version int, messages ...string) string {
+	t.Helper()
+	path := filepath.Join(dir, fmt.Sprintf("v%d.db", version))
+	db, err := sql.Open("sqlite3", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	for _, stmt := range fixtures[version] {
+		if _, err := db.Exec(stmt); err != nil {
+			t.Fatalf("fixture v%d: %v", version, err)
+		}
+	}
+	for _, m := range messages {
+		if _, err := db.Exec(`INSERT INTO messages (type, content, sent_at) VALUES ('text', ?, '2024-01-01T00:00:00Z')`, m); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return path
+}
+
+func tempDir(t *testing.T) (string, func()) {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "store")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dir, func() { os.RemoveAll(dir) }
+}
+
+// withMigration appends a migration for the duration of a test, so that
+// the upgrade path runs from the current version too.
+func withMigration(stmt string) func() {
+	saved := migrations
+	migrations = append(migrations[:len(migrations):len(migrations)], stmt)
+	return func() { migrations = saved }
+}
+
+func checkVersion(t *testing.T, d *DB, want int) {
+	t.Helper()
+	v, err := schemaVersion(d.db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v != want {
+		t.Errorf("user_version = %d, want %d", v, want)
+	}
+}
+
+func checkRecent(t *testing.T, d *DB, want ...string) {
+	t.Helper()
+	got, err := d.Recent(10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(got, "|") != strings.Join(want, "|") {
+		t.Errorf("Recent = %q, want %q", got, want)
+	}
+}
+
+func checkBackup(t *testing.T, path string, version int, want bool) {
+	t.Helper()
+	_, err := os.Stat(fmt.Sprintf("%s.v%d.bak", path, version))
+	if got := err == nil; got != want {
+		t.Errorf("backup of v%d exists = %v, want %v", version, got, want)
+	}
+}
+
+func TestMigrateFromEachVersion(t *testing.T) {
+	defer withMigration(`ALTER TABLE messages ADD COLUMN test_column TEXT`)()
+
+	for version := range fixtures {
+		t.Run(fmt.Sprintf("v%d", version), func(t *testing.T) {
+			dir, cleanup := tempDir(t)
+			defer cleanup()
+			path := fixture(t, dir, version, "first", "second")
+
+			d, err := Open(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer d.Close()
+
+			checkVersion(t, d, len(migrations))
+			checkRecent(t, d, "second", "first")
+			checkBackup(t, path, version, true)
+			if _, err := d.db.Exec(`UPDATE messages SET test_column = 'x'`); err != nil {
+				t.Errorf("last migration not applied: %v", err)
+			}
+
+			// the backup is the database as it was
+			b, err := sql.Open("sqlite3", fmt.Sprintf("%s.v%d.bak", path, version))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer b.Close()
+			if v, err := schemaVersion(b); err != nil || v != version {
+				t.Errorf("backup user_version = %d (%v), want %d", v, err, version)
+			}
+		})
+	}
+}
+
+func TestMigrateCurrentIsNoop(t *testing.T) {
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+	path := fixture(t, dir, len(migrations), "kept")
+
+	d, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+	checkVersion(t, d, len(migrations))
+	checkRecent(t, d, "kept")
+	checkBackup(t, path, len(migrations), false)
+}
+
+func TestMigrateFreshDatabase(t *testing.T) {
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+	path := filepath.Join(dir, "sub", "new.db")
+
+	d, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+	checkVersion(t, d, len(migrations))
+	checkBackup(t, path, 0, false) // nothing to back up
+}
+
+func TestMigrateNewerThanBinary(t *testing.T) {
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+	path := fixture(t, dir, len(migrations), "from the future")
+	db, err := sql.Open("sqlite3", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec(fmt.Sprintf(`PRAGMA user_version = %d`, len(migrations)+1)); err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+
+	d, err := Open(path)
+	if err == nil {
+		d.Close()
+		t.Fatal("Open succeeded on a database newer than the binary")
+	}
+	if !strings.Contains(err.Error(), "newer than supported") {
+		t.Errorf("error = %v, want one about a newer schema", err)
+	}
+}
+
+func TestMigrateFailureKeepsLastVersion(t *testing.T) {
+	defer withMigration(`THIS IS NOT SQL`)()
+
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+	path := fixture(t, dir, 0, "survivor")
+
+	if _, err := Open(path); err == nil {
+		t.Fatal("Open succeeded with a broken migration")
+	}
+	db, err := sql.Open("sqlite3", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if v, err := schemaVersion(db); err != nil || v != len(migrations)-1 {
+		t.Errorf("user_version = %d (%v), want %d", v, err, len(migrations)-1)
+	}
+}
@@ -5,33 +5,55 @@ package store
 
 import (
 	"database/sql"
+	"os"
+	"path/filepath"
 	"time"
 
 	_ "github.com/mattn/go-sqlite3"
 )
 
 const (
-	dbPath = "/var/lib/hexboard/hexboard.db"
-	schema = `CREATE TABLE IF NOT EXISTS messages (
-		id      INTEGER  PRIMARY KEY AUTOINCREMENT,
-		type    TEXT     NOT NULL DEFAULT 'text',
-		content TEXT     NOT NULL,
-		sent_at DATETIME NOT NULL
-	)`
+	// DefaultPath is the database location used on the device.
+	DefaultPath = "/var/lib/hexboard/hexboard.db"
+
+	// Memory opens a private in-memory database; nothing is persisted.
+	// Useful on developer machines and in tests.
+	Memory = ":memory:"
 )
 
-// OpenDB opens (or creates) the SQLite database at /var/lib/hexboard/hexboard.db.
-// WAL mode is enabled via DSN. SetMaxOpenConns(1) serialises writes to avoid
-// SQLITE_BUSY. The schema is created if it does not exist.
-// Returns an error if the data directory does not exist or the DB cannot be opened.
-func OpenDB() (*sql.DB, error) {
-	dsn := dbPath + "?_journal_mode=WAL"
+// Store is the message history as seen by its consumers. *DB implements it;
+// tests can substitute a fake.
+type Store interface {
+	Save(content string) error
+	Recent(n int) ([]string, error)
+}
+
+// DB is a Store backed by an SQLite database.
+type DB struct {
+	db *sql.DB
+}
+
+// Open opens (or creates) the SQLite database at path, creating the parent
+// directory if needed. Pass Memory for an in-memory database.
+// WAL mode is enabled via DSN for file databases. SetMaxOpenConns(1)
+// serialises writes to avoid SQLITE_BUSY (and keeps an in-memory database
+// alive on its single connection). Pending schema migrations are applied
+// (see migrate.go).
+// Returns an error if the directory cannot be created or the DB cannot be opened.
+func Open(path string) (*DB, error) {
+	dsn := path
+	if path != Memory {
+		if err := os.MkdirAll(filepath.Dir(path), 0750); err != nil {
+			return nil, err
+		}
+		dsn += "?_journal_mode=WAL"
+	}
 	db, err := sql.Open("sqlite3", dsn)
 	if err != nil {
 		return nil, err
 	}
 	db.SetMaxOpenConns(1)
-	if err := migrate(db); err != nil {
+	if err := migrate(db, path); err != nil {
 		db.Close()
 		return nil, err
 	}
@@ -39,19 +61,19 @@ func OpenDB() (*sql.DB, error) {
 		db.Close()
 		return nil, err
 	}
-	return db, nil
+	return &DB{db: db}, nil
 }
 
-func migrate(db *sql.DB) error {
-	_, err := db.Exec(schema)
-	return err
+// Close closes the underlying database.
+func (d *DB) Close() error {
+	return d.db.Close()
 }
 
 // Save inserts a text message into the messages table with the current UTC time.
 // Returns an error on failure; the caller is responsible for logging and
 // continuing (fail-soft per project decision — the message still displays).
-func Save(db *sql.DB, content string) error {
-	_, err := db.Exec(
+func (d *DB) Save(content string) error {
+	_, err := d.db.Exec(
 		`INSERT INTO messages (type, content, sent_at) VALUES (?, ?, ?)`,
 		"text", content, time.Now().UTC().Format(time.RFC3339),
 	)
@@ -60,8 +82,8 @@ func Save(db *sql.DB, content string) error {
 
 // Recent returns the n most-recent message contents, newest first.
 // Returns (nil, error) on query failure; the caller falls back to an empty list.
-func Recent(db *sql.DB, n int) ([]string, error) {
-	rows, err := db.Query(
+func (d *DB) Recent(n int) ([]string, error) {
+	rows, err := d.db.Query(
 		`SELECT content FROM messages ORDER BY id DESC LIMIT ?`, n)
 	if err != nil {
 		return nil, err
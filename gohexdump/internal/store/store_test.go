@@ -0,0 +1,46 @@
+package store
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestMemory(t *testing.T) {
+	d, err := Open(Memory)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+	checkVersion(t, d, len(migrations))
+
+	if got, err := d.Recent(5); err != nil || len(got) != 0 {
+		t.Fatalf("Recent on a new database = %q, %v", got, err)
+	}
+	for i := 1; i <= 3; i++ {
+		if err := d.Save(fmt.Sprintf("message %d", i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	checkRecent(t, d, "message 3", "message 2", "message 1")
+	if got, _ := d.Recent(2); len(got) != 2 || got[0] != "message 3" {
+		t.Errorf("Recent(2) = %q", got)
+	}
+}
+
+func TestMemoryIsPrivate(t *testing.T) {
+	a, err := Open(Memory)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+	b, err := Open(Memory)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+
+	if err := a.Save("only in a"); err != nil {
+		t.Fatal(err)
+	}
+	checkRecent(t, b)
+}
@@ -1,56 +1,251 @@
+// Package tcpserver implements the hexboard line protocol on the TCP
+// message port. A client sends one command per line and gets one reply
+// line per command; connections stay open until QUIT or EOF.
+//
+//	MSG <text>          show a one-line message
+//	MSG                 start a multi-line message; following lines are the
+//	                    message, ended by a line holding a single "."
+//	                    (a line starting with ".." is sent as ".")
+//	BIG <text>          show a message in huge characters
+//	CLEAR               clear the text layer
+//	CURSOR <col> <row>  move the cursor
+//	STYLE <name>        set the text style
+//	MODE <mode>         switch mode (e.g. "rain" or "message")
+//	TIMER <name> <d>    start a countdown of duration d (e.g. "5m", "90s")
+//	TIMER <name> UP     start a stopwatch
+//	TIMER <name> STOP   remove a timer
+//	QUIT                close the connection
+//
+// Replies are "OK" or "ERR <reason>". Commands are upper case. Any other
+// line is treated as a one-line message, so the historical
+// `echo hello | nc host 8080` keeps working: that includes lines starting
+// with a command word in another case ("Big news today"), and commands
+// whose arguments do not parse ("CURSOR AT HOME").
 package tcpserver
 
 import (
+	"bufio"
+	"errors"
+	"fmt"
 	"log"
 	"net"
-	"os"
+	"strconv"
+	"strings"
 	"time"
 )
 
-const (
-	HOST = "0.0.0.0"
-	PORT = "8080"
-	TYPE = "tcp"
-)
+// Handler carries out protocol commands. Returned errors are sent to the
+// client as "ERR <error>"; the connection stays open.
+type Handler interface {
+	Message(text string) error
+	Big(text string) error
+	Clear() error
+	Cursor(column, row int) error
+	Style(name string) error
+	Mode(mode string) error
+	Timer(name string, d time.Duration) error // d == 0 starts a stopwatch
+	StopTimer(name string) error
+}
+
+// ErrUnsupported may be returned by a Handler for commands it does not
+// implement.
+var ErrUnsupported = errors.New("not supported")
 
-func Start(ch chan<- byte) {
+// idleTimeout closes connections that send nothing for this long.
+const idleTimeout = 10 * time.Minute
 
-	defer close(ch)
+// maxLines bounds a multi-line message.
+const maxLines = 64
 
-	listen, err := net.Listen(TYPE, HOST+":"+PORT)
+// ListenAndServe listens on addr and serves connections until the listener
+// fails. Errors on individual connections are logged, never fatal.
+func ListenAndServe(addr string, h Handler) error {
+	l, err := net.Listen("tcp", addr)
 	if err != nil {
-		log.Fatal(err)
-		os.Exit(1)
+		return err
 	}
-	// close listener
-	defer listen.Close()
+	defer l.Close()
+	return Serve(l, h)
+}
+
+// Serve accepts connections on l and handles each on its own goroutine.
+func Serve(l net.Listener, h Handler) error {
 	for {
-		conn, err := listen.Accept()
+		conn, err := l.Accept()
 		if err != nil {
-			log.Fatal(err)
-			os.Exit(1)
+			if ne, ok := err.(net.Error); ok && ne.Temporary() {
+				log.Printf("tcpserver: accept: %v", err)
+				time.Sleep(100 * time.Millisecond)
+				continue
+			}
+			return err
 		}
-		go handleRequest(conn, ch)
+		go serveConn(conn, h)
 	}
 }
 
-func handleRequest(conn net.Conn, ch chan<- byte) {
+func serveConn(conn net.Conn, h Handler) {
+	defer conn.Close()
 
-	// incoming request
-	buffer := make([]byte, 1024)
-	_, err := conn.Read(buffer)
-	if err != nil {
-		log.Fatal(err)
+	scanner := bufio.NewScanner(conn)
+	w := bufio.NewWriter(conn)
+
+	reply := func(err error) {
+		if err != nil {
+			fmt.Fprintf(w, "ERR %v\n", err)
+		} else {
+			fmt.Fprintf(w, "OK\n")
+		}
+		w.Flush()
 	}
 
-	for _, v := range buffer {
-		if v != 0 {
-			// log.Default().Printf("(%v) ", v)
-			ch <- v
-			time.Sleep(30 * time.Millisecond)
+	next := func() (string, bool) {
+		conn.SetReadDeadline(time.Now().Add(idleTimeout))
+		if !scanner.Scan() {
+			return "", false
 		}
+		return strings.TrimRight(scanner.Text(), "\r"), true
 	}
 
-	// close conn
-	conn.Close()
+	for {
+		line, ok := next()
+		if !ok {
+			return
+		}
+		cmd, arg := splitCommand(line)
+
+		switch cmd {
+		case "":
+			continue
+
+		case "MSG":
+			if arg != "" {
+				reply(h.Message(arg))
+				continue
+			}
+			// past maxLines, the rest up to "." is read and dropped so
+			// that the next command is in step
+			var lines []string
+			tooLong := false
+			for {
+				l, ok := next()
+				if !ok {
+					return
+				}
+				if l == "." {
+					break
+				}
+				if len(lines) >= maxLines {
+					tooLong = true
+					continue
+				}
+				if strings.HasPrefix(l, "..") {
+					l = l[1:]
+				}
+				lines = append(lines, l)
+			}
+			if tooLong {
+				reply(fmt.Errorf("message longer than %d lines", maxLines))
+				continue
+			}
+			reply(h.Message(strings.Join(lines, "\n")))
+
+		case "BIG":
+			reply(h.Big(arg))
+
+		case "CLEAR":
+			reply(h.Clear())
+
+		case "CURSOR":
+			col, row, _ := parseCursor(arg)
+			reply(h.Cursor(col, row))
+
+		case "STYLE":
+			reply(h.Style(arg))
+
+		case "MODE":
+			reply(h.Mode(strings.ToLower(arg)))
+
+		case "TIMER":
+			name, d, stop, _ := parseTimer(arg)
+			if stop {
+				reply(h.StopTimer(name))
+			} else {
+				reply(h.Timer(name, d))
+			}
+
+		case "QUIT":
+			reply(nil)
+			return
+
+		default:
+			// legacy: a bare line is a message
+			reply(h.Message(line))
+		}
+	}
+}
+
+// splitCommand returns the first word of line, if it is a command whose
+// arguments parse, and the trimmed rest. Anything else yields cmd "?", to
+// be shown as a message.
+func splitCommand(line string) (cmd, arg string) {
+	trimmed := strings.TrimSpace(line)
+	if trimmed == "" {
+		return "", ""
+	}
+	word, rest := trimmed, ""
+	if i := strings.IndexAny(trimmed, " \t"); i >= 0 {
+		word, rest = trimmed[:i], strings.TrimSpace(trimmed[i+1:])
+	}
+	ok := false
+	switch word {
+	case "MSG":
+		ok = true
+	case "BIG":
+		ok = rest != ""
+	case "CLEAR", "QUIT":
+		ok = rest == ""
+	case "STYLE", "MODE":
+		ok = rest != "" && len(strings.Fields(rest)) == 1
+	case "CURSOR":
+		_, _, ok = parseCursor(rest)
+	case "TIMER":
+		_, _, _, ok = parseTimer(rest)
+	}
+	if !ok {
+		return "?", ""
+	}
+	return word, rest
+}
+
+// parseCursor parses the arguments of CURSOR: "<col> <row>".
+func parseCursor(arg string) (col, row int, ok bool) {
+	fields := strings.Fields(arg)
+	if len(fields) != 2 {
+		return 0, 0, false
+	}
+	col, err1 := strconv.Atoi(fields[0])
+	row, err2 := strconv.Atoi(fields[1])
+	return col, row, err1 == nil && err2 == nil
+}
+
+// parseTimer parses the arguments of TIMER: "<name> <duration>|UP|STOP".
+// d is 0 for UP.
+func parseTimer(arg string) (name string, d time.Duration, stop, ok bool) {
+	fields := strings.Fields(arg)
+	if len(fields) != 2 {
+		return "", 0, false, false
+	}
+	name, what := fields[0], fields[1]
+	switch strings.ToUpper(what) {
+	case "UP":
+		return name, 0, false, true
+	case "STOP":
+		return name, 0, true, true
+	}
+	d, err := time.ParseDuration(what)
+	if err != nil || d <= 0 {
+		return "", 0, false, false
+	}
+	return name, d, false, true
 }
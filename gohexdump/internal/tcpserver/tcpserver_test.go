@@ -0,0 +1,192 @@
+package tcpserver
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// recorder is a Handler that records its calls.
+type recorder struct {
+	mutex sync.Mutex
+	calls []string
+}
+
+func (r *recorder) record(format string, args ...interface{}) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.calls = append(r.calls, fmt.Sprintf(format, args...))
+	return nil
+}
+
+func (r *recorder) Message(text string) error { return r.record("Message(%q)", text) }
+func (r *recorder) Big(text string) error     { return r.record("Big(%q)", text) }
+func (r *recorder) Clear() error              { return r.record("Clear()") }
+func (r *recorder) Cursor(c, row int) error   { return r.record("Cursor(%d, %d)", c, row) }
+func (r *recorder) Mode(mode string) error    { return r.record("Mode(%q)", mode) }
+
+func (r *recorder) Style(name string) error {
+	if name == "NOPE" {
+		return errors.New("unknown style")
+	}
+	return r.record("Style(%q)", name)
+}
+
+func (r *recorder) Timer(name string, d time.Duration) error {
+	return r.record("Timer(%q, %v)", name, d)
+}
+
+func (r *recorder) StopTimer(name string) error {
+	if name == "GONE" {
+		return ErrUnsupported
+	}
+	return r.record("StopTimer(%q)", name)
+}
+
+// session sends script on one connection, closes its write side and
+// returns the replies and the handler calls.
+func session(t *testing.T, script string) (replies, calls []string) {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	h := &recorder{}
+	go Serve(l, h)
+
+	conn, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	if _, err := conn.Write([]byte(script)); err != nil {
+		t.Fatal(err)
+	}
+	conn.(*net.TCPConn).CloseWrite()
+	out, err := ioutil.ReadAll(bufio.NewReader(conn))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := strings.TrimSuffix(string(out), "\n"); s != "" {
+		replies = strings.Split(s, "\n")
+	}
+
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	return replies, h.calls
+}
+
+func check(t *testing.T, what string, got, want []string) {
+	t.Helper()
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("%s:\n got %q\nwant %q", what, got, want)
+	}
+}
+
+func TestCommands(t *testing.T) {
+	replies, calls := session(t, strings.Join([]string{
+		"MSG hello there",
+		"BIG 12:59",
+		"CLEAR",
+		"CURSOR 10 2",
+		"STYLE bounce",
+		"STYLE NOPE",
+		"MODE Rain",
+		"TIMER tea 5m",
+		"TIMER lap UP",
+		"TIMER tea stop",
+		"TIMER GONE STOP",
+		"",
+		"QUIT",
+		"MSG not read",
+	}, "\r\n")+"\r\n")
+
+	check(t, "replies", replies, []string{
+		"OK", "OK", "OK", "OK", "OK", "ERR unknown style", "OK",
+		"OK", "OK", "OK", "ERR not supported", "OK",
+	})
+	check(t, "calls", calls, []string{
+		`Message("hello there")`,
+		`Big("12:59")`,
+		`Clear()`,
+		`Cursor(10, 2)`,
+		`Style("bounce")`,
+		`Mode("rain")`,
+		`Timer("tea", 5m0s)`,
+		`Timer("lap", 0s)`,
+		`StopTimer("tea")`,
+	})
+}
+
+func TestMultiLineMessage(t *testing.T) {
+	replies, calls := session(t, "MSG\nBUILD FAILED\n..dotted\n...\n\nmain.go:42\n.\nCLEAR\n")
+	check(t, "replies", replies, []string{"OK", "OK"})
+	check(t, "calls", calls, []string{
+		`Message("BUILD FAILED\n.dotted\n..\n\nmain.go:42")`,
+		`Clear()`,
+	})
+}
+
+func TestMultiLineMessageTooLong(t *testing.T) {
+	var b strings.Builder
+	b.WriteString("MSG\n")
+	for i := 0; i < maxLines+10; i++ {
+		fmt.Fprintf(&b, "line %d\n", i)
+	}
+	b.WriteString(".\nMSG after\n")
+
+	replies, calls := session(t, b.String())
+	check(t, "replies", replies, []string{fmt.Sprintf("ERR message longer than %d lines", maxLines), "OK"})
+	check(t, "calls", calls, []string{`Message("after")`})
+
+	// exactly maxLines is fine
+	b.Reset()
+	b.WriteString("MSG\n")
+	for i := 0; i < maxLines; i++ {
+		b.WriteString("x\n")
+	}
+	b.WriteString(".\n")
+	replies, calls = session(t, b.String())
+	check(t, "replies at the limit", replies, []string{"OK"})
+	if len(calls) != 1 || strings.Count(calls[0], `\n`) != maxLines-1 {
+		t.Errorf("calls at the limit = %q", calls)
+	}
+}
+
+func TestMultiLineMessageUnterminated(t *testing.T) {
+	replies, calls := session(t, "MSG\nhalf a message\n")
+	check(t, "replies", replies, nil)
+	check(t, "calls", calls, nil)
+}
+
+func TestLegacyMessages(t *testing.T) {
+	for _, line := range []string{
+		"hello world",
+		"Big news today",
+		"Timer is up",
+		"Style matters",
+		"msg from a script",
+		"TIMER TEA 0s",
+		"CURSOR AT HOME",
+		"CURSOR 1 2 3",
+		"STYLE OVER SUBSTANCE",
+		"MODE OF TRANSPORT",
+		"BIG",
+		"CLEAR THE DECK",
+		"QUIT SMOKING",
+		"{inverse}ALERT",
+	} {
+		replies, calls := session(t, line+"\n")
+		check(t, line+": replies", replies, []string{"OK"})
+		check(t, line+": calls", calls, []string{fmt.Sprintf("Message(%q)", line)})
+	}
+}
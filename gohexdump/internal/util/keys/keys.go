@@ -19,6 +19,8 @@ const (
 	Escape         = 27
 	Down           = 14
 	Up             = 16
+	PageUp         = 21
+	PageDown       = 22
 	otherBackspace = 127
 )
 
@@ -66,10 +68,25 @@ func Raw(file *os.File, keys chan<- byte) {
 					keys <- Right
 				case byte('D'):
 					keys <- Left
-				case byte('E'):
+				case byte('E'), byte('H'):
 					keys <- Home
 				case byte('F'):
 					keys <- End
+				case byte('5'), byte('6'):
+					tilde, err := getC(file)
+					if err != nil {
+						break
+					}
+					if tilde != byte('~') {
+						keys <- c
+						keys <- cmd
+						keys <- cmd2
+						keys <- tilde
+					} else if cmd2 == byte('5') {
+						keys <- PageUp
+					} else {
+						keys <- PageDown
+					}
 				default:
 					keys <- c
 					keys <- cmd
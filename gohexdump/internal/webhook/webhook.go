@@ -0,0 +1,184 @@
+// Package webhook POSTs board events to configured URLs.
+// It reads a TOML config at /var/lib/hexboard/webhooks.toml; each hook
+// receives the events.Event as JSON, signed with HMAC-SHA256 when a secret
+// is set, and failed deliveries are retried with exponential backoff.
+package webhook
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/BurntSushi/toml"
+
+	"post6.net/gohexdump/internal/events"
+)
+
+const configPath = "/var/lib/hexboard/webhooks.toml"
+
+// Headers sent with every delivery.
+const (
+	EventHeader     = "X-Hexboard-Event"
+	SignatureHeader = "X-Hexboard-Signature" // "sha256=<hex HMAC of body>"
+)
+
+// Config is the contents of webhooks.toml.
+type Config struct {
+	Hooks []Hook `toml:"hook"`
+}
+
+// Hook is one webhook target.
+type Hook struct {
+	URL    string `toml:"url"`
+	Secret string `toml:"secret"`
+
+	// Events limits delivery to these event types; empty means all.
+	Events []events.Type `toml:"events"`
+
+	// Retries is the number of extra attempts after a failure (default 5).
+	// The first retry waits one second, doubling each time.
+	Retries *int `toml:"retries"`
+}
+
+const defaultRetries = 5
+
+// LoadConfig reads /var/lib/hexboard/webhooks.toml.
+// Returns (nil, nil) if the file is absent — webhooks are silently disabled.
+// Returns (nil, err) if the file exists but is malformed or incomplete.
+func LoadConfig() (*Config, error) {
+	var cfg Config
+	_, err := toml.DecodeFile(configPath, &cfg)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	for i, h := range cfg.Hooks {
+		if h.URL == "" {
+			return nil, fmt.Errorf("webhooks.toml: hook %d: url is required", i+1)
+		}
+	}
+	return &cfg, nil
+}
+
+// client has a timeout so an unresponsive endpoint only delays its own queue.
+var client = &http.Client{Timeout: 10 * time.Second}
+
+// Subscribe registers every hook on bus. Each hook has its own queue, so a
+// slow or failing endpoint does not hold up the others.
+func (c *Config) Subscribe(bus *events.Bus) {
+	for i := range c.Hooks {
+		h := c.Hooks[i]
+		bus.Subscribe(func(e events.Event) {
+			if h.wants(e.Type) {
+				h.deliver(e)
+			}
+		})
+	}
+}
+
+func (h *Hook) wants(t events.Type) bool {
+	if len(h.Events) == 0 {
+		return true
+	}
+	for _, w := range h.Events {
+		if w == t {
+			return true
+		}
+	}
+	return false
+}
+
+// Sign returns the SignatureHeader value for body under secret.
+// Receivers recompute it over the raw request body to authenticate it.
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// firstBackoff is the wait before the first retry; tests shorten it.
+var firstBackoff = time.Second
+
+// deliver posts e, retrying on network errors, 429 and 5xx responses.
+// The first attempt is made on the hook's queue, so deliveries start in
+// event order; retries wait on their own goroutine, so a failing endpoint
+// does not back the queue up while it sleeps. Gives up (and logs) after
+// the configured number of retries.
+func (h *Hook) deliver(e events.Event) {
+	body, err := json.Marshal(e)
+	if err != nil {
+		log.Printf("webhook: marshal: %v", err)
+		return
+	}
+	retries := defaultRetries
+	if h.Retries != nil {
+		retries = *h.Retries
+	}
+
+	retry, err := h.post(e.Type, body)
+	if err == nil {
+		return
+	}
+	if !retry || retries <= 0 {
+		log.Printf("webhook: %s: %s: giving up: %v", h.URL, e.Type, err)
+		return
+	}
+	go h.retry(e.Type, body, retries, firstBackoff)
+}
+
+// retry makes up to retries more attempts, waiting backoff before the
+// first and doubling it each time.
+func (h *Hook) retry(t events.Type, body []byte, retries int, backoff time.Duration) {
+	for attempt := 1; ; attempt++ {
+		time.Sleep(backoff)
+		backoff *= 2
+		retry, err := h.post(t, body)
+		if err == nil {
+			return
+		}
+		if !retry || attempt >= retries {
+			log.Printf("webhook: %s: %s: giving up: %v", h.URL, t, err)
+			return
+		}
+	}
+}
+
+// post makes one delivery attempt and reports whether a failure is worth
+// retrying.
+func (h *Hook) post(t events.Type, body []byte) (bool, error) {
+	req, err := http.NewRequest(http.MethodPost, h.URL, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(EventHeader, string(t))
+	if h.Secret != "" {
+		req.Header.Set(SignatureHeader, Sign(h.Secret, body))
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	io.Copy(ioutil.Discard, resp.Body)
+	resp.Body.Close()
+
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		return false, nil
+	case resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500:
+		return true, fmt.Errorf("%s", resp.Status)
+	default:
+		return false, fmt.Errorf("%s", resp.Status)
+	}
+}
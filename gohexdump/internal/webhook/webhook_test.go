@@ -0,0 +1,190 @@
+package webhook
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"post6.net/gohexdump/internal/events"
+)
+
+func TestSign(t *testing.T) {
+	// printf '{"type":"idle"}' | openssl dgst -sha256 -hmac s3cret
+	const want = "sha256=995068950c7efd4fc11547bec7938efc67b5b94c9081ac587ac2c39b59bd05c6"
+	if got := Sign("s3cret", []byte(`{"type":"idle"}`)); got != want {
+		t.Errorf("Sign = %q, want %q", got, want)
+	}
+}
+
+// endpoint is a webhook receiver that fails the first failures requests
+// with status.
+type endpoint struct {
+	*httptest.Server
+	t        *testing.T
+	secret   string
+	status   int
+	failures int
+
+	mutex    sync.Mutex
+	attempts int
+	received []events.Event
+	done     chan struct{} // closed on the first success
+}
+
+func newEndpoint(t *testing.T, secret string, status, failures int) *endpoint {
+	ep := &endpoint{t: t, secret: secret, status: status, failures: failures, done: make(chan struct{})}
+	ep.Server = httptest.NewServer(http.HandlerFunc(ep.serve))
+	return ep
+}
+
+func (ep *endpoint) serve(w http.ResponseWriter, r *http.Request) {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		ep.t.Error(err)
+		return
+	}
+	sig := r.Header.Get(SignatureHeader)
+	if ep.secret == "" && sig != "" {
+		ep.t.Errorf("unsigned hook sent %s %q", SignatureHeader, sig)
+	}
+	if ep.secret != "" && sig != Sign(ep.secret, body) {
+		ep.t.Errorf("%s = %q, want %q", SignatureHeader, sig, Sign(ep.secret, body))
+	}
+	var e events.Event
+	if err := json.Unmarshal(body, &e); err != nil {
+		ep.t.Errorf("body %q: %v", body, err)
+	}
+	if got := r.Header.Get(EventHeader); got != string(e.Type) {
+		ep.t.Errorf("%s = %q, want %q", EventHeader, got, e.Type)
+	}
+
+	ep.mutex.Lock()
+	defer ep.mutex.Unlock()
+	ep.attempts++
+	if ep.attempts <= ep.failures {
+		w.WriteHeader(ep.status)
+		return
+	}
+	ep.received = append(ep.received, e)
+	if len(ep.received) == 1 {
+		close(ep.done)
+	}
+}
+
+func (ep *endpoint) count() (attempts, received int) {
+	ep.mutex.Lock()
+	defer ep.mutex.Unlock()
+	return ep.attempts, len(ep.received)
+}
+
+func retries(n int) *int { return &n }
+
+func shortBackoff() func() {
+	saved := firstBackoff
+	firstBackoff = time.Millisecond
+	return func() { firstBackoff = saved }
+}
+
+func TestDeliverSigned(t *testing.T) {
+	ep := newEndpoint(t, "s3cret", 0, 0)
+	defer ep.Close()
+	for _, secret := range []string{"s3cret", ""} {
+		ep.secret = secret
+		h := &Hook{URL: ep.URL, Secret: secret}
+		h.deliver(events.Event{Type: events.MessageShown, Message: "hello", Time: time.Unix(0, 0).UTC()})
+	}
+	if attempts, received := ep.count(); attempts != 2 || received != 2 {
+		t.Fatalf("%d attempts, %d received, want 2 and 2", attempts, received)
+	}
+	if e := ep.received[0]; e.Type != events.MessageShown || e.Message != "hello" {
+		t.Errorf("received %+v", e)
+	}
+}
+
+func TestDeliverRetries(t *testing.T) {
+	defer shortBackoff()()
+
+	for _, tc := range []struct {
+		name      string
+		status    int
+		failures  int
+		retries   *int
+		attempts  int
+		delivered bool
+	}{
+		{"503 then success", http.StatusServiceUnavailable, 3, nil, 4, true},
+		{"429 then success", http.StatusTooManyRequests, 1, nil, 2, true},
+		{"gives up", http.StatusInternalServerError, 100, nil, 1 + defaultRetries, false},
+		{"configured retries", http.StatusBadGateway, 100, retries(2), 3, false},
+		{"no retries", http.StatusBadGateway, 100, retries(0), 1, false},
+		{"4xx not retried", http.StatusNotFound, 1, nil, 1, false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			ep := newEndpoint(t, "", tc.status, tc.failures)
+			defer ep.Close()
+			h := &Hook{URL: ep.URL, Retries: tc.retries}
+			h.deliver(events.Event{Type: events.Idle})
+
+			if tc.delivered {
+				select {
+				case <-ep.done:
+				case <-time.After(5 * time.Second):
+					t.Fatal("never delivered")
+				}
+			} else {
+				// the backoffs add up to well under this
+				time.Sleep(200 * time.Millisecond)
+			}
+			attempts, received := ep.count()
+			if attempts != tc.attempts {
+				t.Errorf("%d attempts, want %d", attempts, tc.attempts)
+			}
+			if delivered := received > 0; delivered != tc.delivered {
+				t.Errorf("delivered = %v, want %v", delivered, tc.delivered)
+			}
+		})
+	}
+}
+
+func TestDeliverDoesNotBlockOnRetries(t *testing.T) {
+	// a real backoff: retries sleep a second, which deliver must not wait for
+	ep := newEndpoint(t, "", http.StatusServiceUnavailable, 1000)
+	defer ep.Close()
+	h := &Hook{URL: ep.URL}
+
+	start := time.Now()
+	for i := 0; i < 10; i++ {
+		h.deliver(events.Event{Type: events.Idle})
+	}
+	if d := time.Since(start); d > firstBackoff/2 {
+		t.Errorf("10 failing deliveries took %v", d)
+	}
+	if attempts, _ := ep.count(); attempts != 10 {
+		t.Errorf("%d first attempts, want 10", attempts)
+	}
+}
+
+func TestSubscribeFilters(t *testing.T) {
+	ep := newEndpoint(t, "", 0, 0)
+	defer ep.Close()
+	cfg := &Config{Hooks: []Hook{{URL: ep.URL, Events: []events.Type{events.TimerDone}}}}
+	var bus events.Bus
+	cfg.Subscribe(&bus)
+
+	bus.Publish(events.Event{Type: events.Idle})
+	bus.Publish(events.Event{Type: events.TimerDone, Message: "tea"})
+	select {
+	case <-ep.done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("never delivered")
+	}
+	ep.mutex.Lock()
+	defer ep.mutex.Unlock()
+	if len(ep.received) != 1 || ep.received[0].Type != events.TimerDone || ep.received[0].Message != "tea" {
+		t.Errorf("received %+v, want only the timer", ep.received)
+	}
+}